@@ -1,22 +1,105 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/rand"
 	"net"
+	"net/http"
+	"net/netip"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"runtime/debug"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"text/template"
 	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/term"
 )
 
 const (
 	defaultTimeout = 500 * time.Millisecond
 	defaultThreads = 100
 	version        = "1.0.0"
+	ipprotoSCTP    = 132
+	bannerDumpSize = 64
+
+	bannerReadTimeout = 200 * time.Millisecond
+
+	exitDiscrepancy = 3
+	exitNoOpenPorts = 4
+	exitCritical    = 2
+	maxRate         = 1000000
+
+	minRateBurstFactor = 2
+
+	fastClosedBurstFactor = 4
+	fastClosedRatio       = 0.9
+	fastClosedCheckEvery  = 256
+
+	autoThreadsStart    = 10
+	autoThreadsInterval = 250 * time.Millisecond
+	autoThreadsBackoff  = 0.2
+	autoThreadsRampUp   = 0.05
+
+	synDropSpike        = 0.5
+	synDropMinResults   = 20
+	synDropStuckWindows = 4
+
+	maxCIDRBits = 16
+
+	tarpitMinPorts  = 100
+	tarpitOpenRatio = 0.9
+	tarpitLatencyCV = 1.0
+
+	closedSampleSize = 5
+
+	reasonCollapseMin = 25
+
+	hostUnreachMinResults = 5
+
+	maxConfirmProbes = 10
+
+	callbackBatchWindow = 500 * time.Millisecond
+	callbackMaxBatch    = 100
+	callbackQueueSize   = 4096
+
+	confirmScanAbove = 5 * time.Minute
+
+	matrixMaxPorts = 16
+
+	autoRetryDelayWAN = 100 * time.Millisecond
+	maxRetryDelay     = 30 * time.Second
+
+	allFilteredRatio = 0.99
+
+	dnsRetries      = 3
+	dnsRetryBackoff = 500 * time.Millisecond
 )
 
 var commonPorts = map[int]string{
@@ -42,42 +125,987 @@ var commonPorts = map[int]string{
 	8080: "HTTP-Proxy",
 }
 
+// osKeywords associa trechos comuns em banners ao sistema operacional que
+// costumam indicar; a ordem desempata hosts com a mesma contagem.
+var osKeywords = []struct {
+	keyword string
+	os      string
+}{
+	{"ubuntu", "Ubuntu"},
+	{"debian", "Debian"},
+	{"raspbian", "Raspbian"},
+	{"centos", "CentOS"},
+	{"red hat", "Red Hat"},
+	{"rhel", "Red Hat"},
+	{"fedora", "Fedora"},
+	{"suse", "SUSE"},
+	{"alpine", "Alpine"},
+	{"freebsd", "FreeBSD"},
+	{"openbsd", "OpenBSD"},
+	{"microsoft", "Windows"},
+	{"windows", "Windows"},
+	{"win32", "Windows"},
+	{"win64", "Windows"},
+}
+
+var builtinTopPorts = []int{
+	80, 23, 443, 21, 22, 25, 3389, 110, 445, 139, 143, 53, 135, 3306, 8080,
+	1723, 111, 995, 993, 5900, 1025, 587, 8888, 199, 1720, 465, 548, 113, 81,
+	6001, 10000, 514, 5060, 179, 1026, 2000, 8443, 8000, 32768, 554, 26, 1433,
+	49152, 2001, 515, 8008, 49154, 1027, 5666, 646, 5000, 5631, 631, 49153,
+	8081, 2049, 88, 79, 5800, 106, 2121, 1110, 49155, 6000, 513, 990, 5357,
+	427, 49156, 543, 544, 5101, 144, 7, 389,
+}
+
+// osTopPorts são as portas priorizadas por -os-weighted-ports quando o SO do
+// host já foi inferido; qualquer palpite que não seja Windows usa a lista Unix.
+var osTopPorts = map[string][]int{
+	"Windows": {135, 139, 445, 3389, 5985, 5986, 1433, 593, 88, 389, 636, 3268, 49152, 49153, 49154},
+	"Unix":    {22, 111, 2049, 3306, 5432, 6379, 11211, 27017, 631, 873, 9100, 10000},
+}
+
+var quiet bool
+
+var progress bool
+
+// runID identifica a execução em todas as saídas (texto, JSON, arquivos e
+// webhooks), para correlacionar resultados de uma mesma invocação.
+var runID string
+
+// bannerEncoding define como banners são exibidos: safe, utf8, latin1 ou hex.
+var bannerEncoding = "safe"
+
+var sendTimeoutOption = map[string]int{
+	"linux":   0x15,
+	"darwin":  0x1005,
+	"freebsd": 0x1005,
+}
+
+var servicesFileCache = make(map[string][]int)
+
+var configAliases = map[string]string{
+	"ports":   "p",
+	"threads": "t",
+	"verbose": "v",
+	"ipv4":    "4",
+}
+
 type PortResult struct {
-	Port    int
-	State   string
-	Service string
+	Port       int           `json:"port"`
+	State      string        `json:"state"`
+	Service    string        `json:"service"`
+	Banner     string        `json:"banner,omitempty"`
+	BannerHash string        `json:"banner_hash,omitempty"`
+	Reason     string        `json:"reason,omitempty"`
+	Retries    int           `json:"retries,omitempty"`
+	Confidence string        `json:"confidence,omitempty"`
+	Paths      []HTTPPath    `json:"http_paths,omitempty"`
+	Latency    time.Duration `json:"latency_ns"`
+	Timing     *PortTiming   `json:"timing,omitempty"`
+	TCP        *TCPDetails   `json:"tcp,omitempty"`
+	TLS        *TLSCheck     `json:"tls,omitempty"`
+}
+
+// PortTiming detalha onde o tempo de uma porta aberta foi gasto; só é
+// preenchido com -timing-debug.
+type PortTiming struct {
+	Dial   time.Duration `json:"dial_ns"`
+	Banner time.Duration `json:"banner_ns"`
+	Probe  time.Duration `json:"probe_ns"`
+}
+
+// TCPDetails traz sinais de baixo nível da conexão aberta, úteis para
+// fingerprint do SO; só é preenchido com -tcp-details. Sem scan SYN com raw
+// socket, os valores vêm do kernel após o handshake completo: Window é a
+// janela anunciada pelo host (já com window scaling) e MSS é o tamanho de
+// segmento efetivo, não os campos crus do SYN-ACK.
+type TCPDetails struct {
+	Window uint32 `json:"window"`
+	MSS    uint32 `json:"mss"`
+}
+
+// TLSCheck diz se o certificado de uma porta TLS vale para o nome que o
+// usuário escaneou; só é preenchido com -verify-tls-hostname. Problem é
+// hostname-mismatch, self-signed, unknown-authority, expired ou invalid.
+type TLSCheck struct {
+	Name    string `json:"name"`
+	Valid   bool   `json:"valid"`
+	Problem string `json:"problem,omitempty"`
+}
+
+// SafeBanner é o banner no formato do -banner-encoding, pronto para o
+// terminal; Banner segue com os bytes crus.
+func (r PortResult) SafeBanner() string {
+	return renderBanner(r.Banner)
+}
+
+// bannerHash resume o banner em um FNV-1a de 64 bits: entre dois scans, um
+// hash diferente na mesma porta aberta indica que o serviço mudou.
+func bannerHash(banner string) string {
+	if banner == "" {
+		return ""
+	}
+	h := fnv.New64a()
+	h.Write([]byte(banner))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+func escapeBanner(banner string) string {
+	var b strings.Builder
+	for i := 0; i < len(banner); i++ {
+		c := banner[i]
+		switch {
+		case c == '\n':
+			b.WriteString("\\n")
+		case c == '\r':
+			b.WriteString("\\r")
+		case c == '\t':
+			b.WriteString("\\t")
+		case c < 0x20 || c > 0x7e:
+			fmt.Fprintf(&b, "\\x%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// renderBanner formata o banner para exibição conforme o -banner-encoding.
+// Exceto em hex, bytes e runas não imprimíveis viram escapes, para que o
+// banner não corrompa o terminal.
+func renderBanner(banner string) string {
+	var b strings.Builder
+	switch bannerEncoding {
+	case "hex":
+		return hex.EncodeToString([]byte(banner))
+	case "utf8":
+		for i := 0; i < len(banner); {
+			r, size := utf8.DecodeRuneInString(banner[i:])
+			if r == utf8.RuneError && size == 1 {
+				fmt.Fprintf(&b, "\\x%02x", banner[i])
+			} else {
+				writeBannerRune(&b, r)
+			}
+			i += size
+		}
+	case "latin1":
+		for _, r := range decodeLatin1(banner) {
+			writeBannerRune(&b, r)
+		}
+	default:
+		return escapeBanner(banner)
+	}
+	return b.String()
+}
+
+func writeBannerRune(b *strings.Builder, r rune) {
+	switch {
+	case r == '\n':
+		b.WriteString("\\n")
+	case r == '\r':
+		b.WriteString("\\r")
+	case r == '\t':
+		b.WriteString("\\t")
+	case unicode.IsPrint(r):
+		b.WriteRune(r)
+	case r < 0x100:
+		fmt.Fprintf(b, "\\x%02x", r)
+	default:
+		fmt.Fprintf(b, "\\u%04x", r)
+	}
+}
+
+// decodeLatin1 converte ISO-8859-1 para UTF-8: cada byte é a runa de mesmo
+// valor.
+func decodeLatin1(banner string) string {
+	runes := make([]rune, len(banner))
+	for i := 0; i < len(banner); i++ {
+		runes[i] = rune(banner[i])
+	}
+	return string(runes)
+}
+
+// jsonBanners aplica o -banner-encoding aos banners de saídas JSON. Em safe e
+// utf8 o banner segue cru, pois o próprio JSON escapa caracteres de controle;
+// latin1 decodifica os bytes e hex os codifica.
+func jsonBanners(results []PortResult) []PortResult {
+	if bannerEncoding != "latin1" && bannerEncoding != "hex" {
+		return results
+	}
+	encoded := make([]PortResult, len(results))
+	for i, r := range results {
+		if bannerEncoding == "hex" {
+			r.Banner = hex.EncodeToString([]byte(r.Banner))
+		} else {
+			r.Banner = decodeLatin1(r.Banner)
+		}
+		encoded[i] = r
+	}
+	return encoded
+}
+
+func isTextBanner(banner string) bool {
+	for i := 0; i < len(banner); i++ {
+		c := banner[i]
+		if (c < 0x20 || c > 0x7e) && c != '\n' && c != '\r' && c != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// serviceHint descreve uma resposta que não identifica o serviço pelo
+// tamanho e pelo tipo de conteúdo; o primeiro byte de protocolos binários
+// costuma apontar a família (0x16 é um handshake TLS, por exemplo).
+func serviceHint(banner string) string {
+	if isTextBanner(banner) {
+		return fmt.Sprintf("protocolo texto, %d bytes", len(banner))
+	}
+	return fmt.Sprintf("protocolo binário (0x%02x), %d bytes", banner[0], len(banner))
+}
+
+type StreamRecord struct {
+	RunID     string    `json:"run_id"`
+	Host      string    `json:"host"`
+	Timestamp time.Time `json:"timestamp"`
+	PortResult
+}
+
+type HTTPPath struct {
+	Path   string `json:"path"`
+	Status int    `json:"status"`
+}
+
+type HostResults struct {
+	RunID   string       `json:"run_id"`
+	Host    string       `json:"host"`
+	Results []PortResult `json:"results"`
+}
+
+type postScanHook func(host string, results []PortResult)
+
+var postScanHooks []postScanHook
+
+type ScanTarget struct {
+	IP     string
+	Family string
+	Names  []string
+	PTR    string
+}
+
+func (t ScanTarget) Label() string {
+	return strings.Join(t.Names, ", ")
+}
+
+func (t ScanTarget) Address() string {
+	addr := t.IP + ", " + t.Family
+	if isLoopback(t.IP) {
+		addr += ", loopback"
+	}
+	if t.PTR != "" {
+		addr += ", PTR " + t.PTR
+	}
+	return addr
+}
+
+type ResolveOptions struct {
+	Dual       bool
+	PreferIPv4 bool
+	// Family, quando definido por -4only ou -6only, é a única família aceita:
+	// hosts sem endereço dela são rejeitados em vez de cair na outra.
+	Family   string
+	ShowAll  bool
+	AllAddrs bool
+}
+
+type OutputOptions struct {
+	Template           *template.Template
+	ShowReason         bool
+	FingerprintUnknown bool
+	ShowHost           bool
+	Host               string
+}
+
+type HostScan struct {
+	IP       string
+	Results  []PortResult
+	All      []PortResult
+	Scanned  int
+	Skipped  int
+	Stats    ScanStats
+	Status   string
+	Threads  int
+	Samples  map[string][]int
+	Filtered []int
+}
+
+type ScanStats struct {
+	Total   int            `json:"total_ports"`
+	States  map[string]int `json:"states"`
+	Errors  int            `json:"errors"`
+	Rescued int            `json:"rescued_by_retry,omitempty"`
+	Retried int            `json:"filtered_after_retry,omitempty"`
+	Elapsed float64        `json:"elapsed_seconds"`
+	Rate    float64        `json:"ports_per_second"`
+}
+
+type JSONHost struct {
+	Host     string       `json:"host"`
+	Names    []string     `json:"names"`
+	Family   string       `json:"family"`
+	Status   string       `json:"status"`
+	Results  []PortResult `json:"results"`
+	Stats    ScanStats    `json:"stats"`
+	OSGuess  string       `json:"os_guess,omitempty"`
+	PTR      string       `json:"ptr,omitempty"`
+	Filtered []int        `json:"filtered,omitempty"`
+	New      []int        `json:"baseline_new,omitempty"`
+	Missing  []int        `json:"baseline_missing,omitempty"`
+}
+
+type JSONReport struct {
+	RunID string     `json:"run_id"`
+	Proxy string     `json:"proxy,omitempty"`
+	Hosts []JSONHost `json:"hosts"`
+	Stats ScanStats  `json:"stats"`
+}
+
+func newScanStats() ScanStats {
+	return ScanStats{States: make(map[string]int)}
+}
+
+func (s *ScanStats) record(result PortResult) {
+	s.Total++
+	s.States[result.State]++
+	if result.Reason == "error" || result.State == "error" {
+		s.Errors++
+	}
+	if result.Retries > 0 {
+		switch result.State {
+		case "open":
+			s.Rescued++
+		case "filtered":
+			s.Retried++
+		}
+	}
+}
+
+func (s *ScanStats) merge(other ScanStats) {
+	s.Total += other.Total
+	s.Errors += other.Errors
+	s.Rescued += other.Rescued
+	s.Retried += other.Retried
+	for state, n := range other.States {
+		s.States[state] += n
+	}
+}
+
+// reclassify move uma porta já contada de um estado para outro, como quando
+// -rescan-filtered obtém resposta de uma porta antes filtrada.
+func (s *ScanStats) reclassify(from, to string) {
+	if s.States == nil {
+		s.States = make(map[string]int)
+	}
+	s.States[from]--
+	s.States[to]++
+}
+
+func (s *ScanStats) finish(elapsed time.Duration) {
+	s.Elapsed = elapsed.Seconds()
+	if s.Elapsed > 0 {
+		s.Rate = float64(s.Total-s.States["skipped"]) / s.Elapsed
+	}
+}
+
+type ScanOptions struct {
+	Protocol      string
+	Threads       int
+	Timeout       time.Duration
+	Verbose       bool
+	GroupVerbose  bool
+	StatsEvery    time.Duration
+	GracefulClose bool
+	Rate          int
+	MinRate       int
+	AutoThreads   bool
+	FailFast      bool
+	MaxOpen       int
+	FastClosed    bool
+	TwoPhase      bool
+	TimingDebug   bool
+	TCPDetails    bool
+	GrabBanners   bool
+	HostTimeout   time.Duration
+	Retries       int
+	ResetRetries  int
+	RetryDelay    time.Duration
+	RetryAuto     bool
+	RetryBackoff  float64
+	ConfirmNeed   int
+	ConfirmOf     int
+	ProbeTimeout  time.Duration
+	ProbeOrder    []string
+	OSWeighted    bool
+	NoSynBackoff  bool
+	HostIndex     int
+	HostCount     int
+	RetryBudget   *retryBudget
+	Dial          func(ctx context.Context, network, address string) (net.Conn, error)
+	KeepAll       bool
+	OnResult      func(ip string, result PortResult)
 }
 
 func showCustomHelp() {
 	fmt.Println("Argos - Scanner de Portas TCP")
 	fmt.Printf("Versão: %s\n\n", version)
 	fmt.Println("USO:")
-	fmt.Println("  go run argos.go [opções]")
+	fmt.Println("  go run . [opções]")
 	fmt.Println("\nOPÇÕES:")
 	fmt.Println("  -host string")
-	fmt.Println("        Host para escanear (obrigatório)")
+	fmt.Println("        Host(s), redes CIDR ou intervalos por octeto (ex: 192.168.1.1-254) para escanear, separados por vírgula (obrigatório)")
+	fmt.Println("  -targets string")
+	fmt.Println("        Verifica apenas os pares host:porta informados, em vez de todas as portas de cada host (ex: host1:22,host2:443,1.2.3.4:3306)")
+	fmt.Println("        Sem verificação de host online; exibe só a tabela de pares e não aceita -host, -json, -jsonl, -greppable, -count-only, -ports-only, -sY, -o, -output-dir, -webhook, -results-callback, -baseline, -syslog, -resolve-ptr nem -verify-tls-hostname")
+	fmt.Println("  -exclude-hosts string")
+	fmt.Println("        Endereços ou redes CIDR removidos dos alvos (ex: 10.0.0.5,10.0.1.0/24)")
 	fmt.Println("  -p string")
-	fmt.Println("        Range de portas para escanear (ex: 22,80,100-200) (default \"1-1024\")")
+	fmt.Println("        Range de portas para escanear (ex: 22,80,100-200,ssh,https) (default \"1-1024\")")
+	fmt.Println("  -scan-all, -p-")
+	fmt.Println("        Escaneia todas as portas (1-65535); exibe a estimativa de duração e pede confirmação no terminal, exceto com -y")
+	fmt.Println("  -y, -yes")
+	fmt.Printf("        Não pede confirmação antes de scans grandes (todas as portas ou estimativa acima de %s)\n", confirmScanAbove)
+	fmt.Println("  -est-time")
+	fmt.Println("        Exibe a duração estimada (limite superior: portas × tentativas × timeout ÷ threads, ou o -rate) e sai sem escanear")
 	fmt.Println("  -t int")
 	fmt.Printf("        Número de threads concorrentes (default %d)\n", defaultThreads)
-	fmt.Println("  -timeout int")
-	fmt.Printf("        Timeout em milissegundos (default %d)\n", int(defaultTimeout/time.Millisecond))
+	fmt.Println("  -rate int")
+	fmt.Println("        Máximo de novas conexões por segundo; -t limita as conexões simultâneas (default 0, sem limite)")
+	fmt.Println("  -min-rate int")
+	fmt.Printf("        Mínimo de novas conexões por segundo; abre conexões extras, até %dx o valor de -t, quando as threads estão ocupadas\n", minRateBurstFactor)
+	fmt.Println("  -timeout duration")
+	fmt.Printf("        Timeout de conexão, ex: 500ms ou 2s; número puro é lido em milissegundos (default %s)\n", defaultTimeout)
+	fmt.Println("  -auto-threads")
+	fmt.Printf("        Começa com %d threads e ajusta a concorrência pela taxa de timeouts, usando -t como teto\n", autoThreadsStart)
+	fmt.Println("  -skip-closed-fast")
+	fmt.Printf("        Quando %.0f%% das portas são recusadas de imediato (RST), amplia as threads até %dx o valor de -t\n", fastClosedRatio*100, fastClosedBurstFactor)
+	fmt.Println("  -max-open int")
+	fmt.Println("        Para de escanear o host após N portas abertas e o marca como provável tarpit (default 0, sem limite)")
+	fmt.Println("  -fail-fast")
+	fmt.Printf("        Interrompe o scan na primeira porta aberta; sem nenhuma aberta, sai com código %d\n", exitNoOpenPorts)
+	fmt.Println("  -retries int")
+	fmt.Println("        Novas tentativas por porta quando a conexão expira (default 0)")
+	fmt.Println("  -retry-on-reset int")
+	fmt.Println("        Novas tentativas por porta após conexão recusada, para balanceadores que enviam RST sob carga (default 0)")
+	fmt.Println("  -retry-delay string")
+	fmt.Printf("        Pausa antes de cada nova tentativa (ex: 200ms, 0 = sem pausa); auto não espera em loopback e redes privadas e espera %s nos demais hosts (default auto)\n", autoRetryDelayWAN)
+	fmt.Println("  -retry-backoff float")
+	fmt.Println("        Multiplica a pausa a cada nova tentativa, para backoff exponencial; 1 mantém a pausa fixa (default 2)")
+	fmt.Println("  -min-open-confidence, -confidence string")
+	fmt.Println("        Só considera aberta a porta que aceitar K de até N conexões (ex: 2/3), para alvos que aceitam de forma intermitente; a votação de cada porta aparece como CONFIANÇA e no JSON")
+	fmt.Println("  -retry-budget int")
+	fmt.Println("        Limite total de novas tentativas no scan; esgotado, timeouts viram filtered sem retry (default 0, sem limite)")
+	fmt.Println("  -probe-timeout duration")
+	fmt.Printf("        Tempo de espera por banners e respostas de probes, separado do timeout de conexão (default %s)\n", bannerReadTimeout)
+	fmt.Println("  -probe-order string")
+	fmt.Println("        Ordem dos probes de identificação, separados por vírgula (default read; read,http no -banner-only)")
+	fmt.Println("        read: só lê o banner; http: envia HEAD /; crlf: envia uma linha em branco")
+	fmt.Println("  -host-timeout duration")
+	fmt.Println("        Tempo máximo por host; portas restantes são marcadas como skipped (ex: 30s, 5m)")
 	fmt.Println("  -v")
 	fmt.Println("        Modo verbose - exibe mais informações")
+	fmt.Println("  -group-verbose")
+	fmt.Println("        Modo verbose com os resultados de cada host agrupados em um bloco ao fim do host")
 	fmt.Println("  -4")
-	fmt.Println("        Usar apenas IPv4 (default true)")
+	fmt.Println("        Preferir IPv4; se o host só tiver IPv6, avisa e usa IPv6 (default true)")
+	fmt.Println("  -4only")
+	fmt.Println("        Exige IPv4: um host sem registro A é rejeitado com erro, sem cair para IPv6")
+	fmt.Println("  -6only")
+	fmt.Println("        Exige IPv6: um host sem registro AAAA é rejeitado com erro, sem cair para IPv4")
 	fmt.Println("  -Pn")
 	fmt.Println("        Pular host discovery (assume host online)")
+	fmt.Println("  -alive-ports string")
+	fmt.Println("        Portas TCP testadas na verificação de host online, antes do ping (default \"80,443\")")
+	fmt.Println("  -randomize")
+	fmt.Println("        Escaneia as portas em ordem aleatória (o conjunto escaneado é o mesmo)")
+	fmt.Println("  -seed int")
+	fmt.Println("        Semente do -randomize para reproduzir a mesma ordem; 0 usa o horário (exibida com -v)")
+	fmt.Println("  -limit-hosts int")
+	fmt.Println("        Escaneia só N dos hosts expandidos: os primeiros, ou N sorteados com -randomize (default 0, todos)")
+	fmt.Println("  -top-ports int")
+	fmt.Println("        Escaneia as N portas mais comuns (substitui -p)")
+	fmt.Println("  -services-file string")
+	fmt.Println("        Arquivo nmap-services para ordenar o -top-ports e o -smart-order por frequência")
+	fmt.Println("  -smart-order")
+	fmt.Println("        Escaneia as portas pedidas da mais à menos comum, para que -fail-fast e os primeiros resultados saiam antes; o conjunto e a exibição (numérica) não mudam")
+	fmt.Println("  -watch int")
+	fmt.Println("        Monitora uma porta continuamente, exibindo disponibilidade e latência")
+	fmt.Println("  -interval int")
+	fmt.Println("        Intervalo em segundos entre verificações do -watch (default 5)")
+	fmt.Println("  -sY")
+	fmt.Println("        Scan de portas SCTP em vez de TCP")
+	fmt.Println("  -no-progress")
+	fmt.Println("        Desativa a barra de progresso (automático quando a saída não é um terminal)")
+	fmt.Println("        Com vários hosts, a barra mostra os hosts concluídos e o andamento das portas do host atual")
+	fmt.Println("  -stats-every duration")
+	fmt.Println("        Exibe uma linha de progresso a cada intervalo (ex: 10s, 0 desativa)")
+	fmt.Println("  -http-paths string")
+	fmt.Println("        Wordlist de caminhos testados com HEAD em portas HTTP abertas (exibe 200/301/403)")
+	fmt.Println("  -ssh-jump string")
+	fmt.Println("        Conecta a um bastion SSH (usuário@host[:porta]) e escaneia a partir dele (implica -Pn)")
+	fmt.Println("  -ssh-key string")
+	fmt.Println("        Chave privada para o -ssh-jump (default ~/.ssh/id_ed25519, id_ecdsa ou id_rsa)")
+	fmt.Println("  -ssh-known-hosts string")
+	fmt.Println("        known_hosts usado para validar a chave do bastion (default ~/.ssh/known_hosts)")
+	fmt.Println("  -http-proxy string")
+	fmt.Println("        Abre um túnel HTTP CONNECT até cada porta através do proxy host:porta (implica -Pn)")
+	fmt.Println("  -proxy-auth string")
+	fmt.Println("        Credenciais usuário:senha enviadas ao proxy HTTP (Basic)")
+	fmt.Println("  -show-host")
+	fmt.Println("        Inclui a coluna HOST na tabela; ativado automaticamente quando há mais de um host")
+	fmt.Println("  -timing-debug")
+	fmt.Println("        Exibe por porta aberta o tempo de conexão (com retries), de leitura do banner e dos probes HTTP")
+	fmt.Println("  -tcp-details")
+	fmt.Println("        Exibe por porta aberta a janela TCP anunciada pelo host e o MSS efetivo, lidos do kernel após o handshake (Linux; não são os campos crus do SYN-ACK)")
+	fmt.Println("  -verify-tls-hostname")
+	fmt.Println("        Faz um handshake TLS em cada porta aberta e valida o certificado contra o nome escaneado, exibindo se é válido ou o problema (nome divergente, autoassinado, CA desconhecida, expirado)")
+	fmt.Println("  -two-phase")
+	fmt.Println("        Descobre as portas abertas sem ler banners e depois coleta os banners só das abertas, exibindo o tempo de cada fase")
+	fmt.Println("  -passive-os-guess")
+	fmt.Println("        Lê o banner de todas as portas abertas e infere o SO do host pelas palavras-chave (ex: Ubuntu, Debian)")
+	fmt.Println("  -no-syn-backoff")
+	fmt.Println("        Desativa a redução automática de threads quando os timeouts disparam no meio do scan (possível descarte de SYNs)")
+	fmt.Println("  -os-weighted-ports")
+	fmt.Println("        Com -top-ports e -passive-os-guess, antecipa as portas típicas do SO (ex: 445, 3389, 135 no Windows) assim que um palpite surge")
+	fmt.Println("  -banner-only")
+	fmt.Println("        Apenas conecta às portas informadas e exibe seus banners, sem tabela de estados")
+	fmt.Println("  -format string")
+	fmt.Println("        Template Go aplicado a cada porta (campos: Port, State, Service, Banner, SafeBanner, BannerHash, Reason, Latency)")
+	fmt.Println("  -graceful-close")
+	fmt.Println("        Encerra conexões abertas com half-close (FIN), evitando RSTs detectáveis por IDS")
+	fmt.Println("  -traceroute")
+	fmt.Println("        Exibe a rota até o host (requer traceroute instalado)")
+	fmt.Println("  -o string")
+	fmt.Println("        Grava os resultados de cada host no arquivo informado")
+	fmt.Println("  -output-dir string")
+	fmt.Println("        Grava os resultados de cada host em <dir>/<ip>.<formato> (cria o diretório se necessário)")
+	fmt.Println("  -output-format string")
+	fmt.Println("        Formato dos arquivos do -output-dir: txt ou json (default \"txt\")")
+	fmt.Println("  -webhook string")
+	fmt.Println("        Envia os resultados de cada host em JSON via POST para a URL")
+	fmt.Println("  -results-callback string")
+	fmt.Printf("        Envia via POST cada porta aberta assim que encontrada, em lotes JSON de até %d portas a cada %s; falhas só geram aviso\n", callbackMaxBatch, callbackBatchWindow)
+	fmt.Println("  -syslog")
+	fmt.Println("        Envia cada porta aberta ao syslog local (NOTICE, facility daemon) como host=... port=... service=...")
+	fmt.Println("  -syslog-addr string")
+	fmt.Println("        Servidor syslog remoto em [udp|tcp://]host:porta (porta 514 se omitida); implica -syslog")
+	fmt.Println("  -detect-tarpit")
+	fmt.Printf("        Marca como provável tarpit o host com %.0f%%+ de %d ou mais portas abertas, banner idêntico e latência uniforme, omitindo a lista\n", tarpitOpenRatio*100, tarpitMinPorts)
+	fmt.Println("  -baseline string")
+	fmt.Println("        Relatório -json de um scan anterior: portas abertas fora dele são destacadas assim que encontradas, e o resumo de cada host lista as NOVAS e as AUSENTES")
+	fmt.Println("  -rescan-filtered string")
+	fmt.Println("        Relatório -json anterior: reescaneia só as portas filtradas dos hosts dele e exibe o que mudou (com -json, o relatório atualizado); use -timeout e -retries maiores que os da primeira passagem")
+	fmt.Println("  -detect-flapping")
+	fmt.Println("        Escaneia cada host duas vezes e exibe as portas que mudaram de estado ou de banner (hash)")
+	fmt.Println("  -flap-delay duration")
+	fmt.Println("        Intervalo entre as passagens do -detect-flapping (default 5s)")
+	fmt.Println("  -rollup")
+	fmt.Println("        Exibe ao final quantos hosts expõem cada serviço")
+	fmt.Println("  -matrix")
+	fmt.Printf("        Em vez da tabela por host, exibe ao final uma grade host × porta com o estado de cada par e quantos hosts têm cada porta aberta (até %d portas; ex: -host 10.0.0.0/24 -p 22 -matrix)\n", matrixMaxPorts)
+	fmt.Println("  -only-services string")
+	fmt.Println("        Exibe apenas os serviços listados, separados por vírgula (ex: ssh,http); todas as portas continuam sendo escaneadas")
+	fmt.Println("  -sort string")
+	fmt.Println("        Ordena os resultados por port, latency (mais lentas primeiro), service ou state (default \"port\")")
+	fmt.Println("  -assert-open string")
+	fmt.Printf("        Portas que precisam estar abertas; imprime OK/CRITICAL no estilo Nagios e sai com 0 ou %d\n", exitCritical)
+	fmt.Println("  -assert-closed string")
+	fmt.Println("        Portas que precisam estar fechadas ou filtradas; combina com -assert-open")
+	fmt.Println("  -expect string")
+	fmt.Printf("        Portas esperadas abertas; divergências retornam código de saída %d\n", exitDiscrepancy)
+	fmt.Println("  -fingerprint-unknown")
+	fmt.Printf("        Exibe dump hexadecimal dos primeiros %d bytes do banner de serviços desconhecidos\n", bannerDumpSize)
+	fmt.Println("  -banner-encoding string")
+	fmt.Println("        Como exibir banners: safe (ASCII, demais bytes como \\xNN), utf8, latin1 ou hex; não imprimíveis sempre viram escapes (default safe)")
+	fmt.Println("        Vale para -banner-only, -fingerprint-unknown e SafeBanner do -format; no JSON, latin1 e hex convertem o campo banner")
+	fmt.Println("  -reason")
+	fmt.Println("        Exibe o motivo de cada estado (syn-ack, conn-refused, no-response after 2 retries...), incluindo portas fechadas e filtradas")
+	fmt.Println("  -run-id string")
+	fmt.Println("        ID da execução incluído no texto, JSON, -greppable, arquivos e webhooks (default: data e hora + sufixo aleatório)")
+	fmt.Println("        -ports-only e -count-only não o incluem, para que a saída continue sendo só portas ou contagens")
+	fmt.Println("  -json")
+	fmt.Println("        Emite o resultado completo em JSON, com estatísticas do scan, ao final")
+	fmt.Println("  -json-pretty")
+	fmt.Println("        Indenta o JSON para leitura; implica -json, ou indenta cada registro do -jsonl")
+	fmt.Println("  -jsonl")
+	fmt.Println("        Emite cada porta aberta como uma linha JSON (com host e timestamp) assim que encontrada")
+	fmt.Println("  -ports-only")
+	fmt.Println("        Exibe apenas as portas abertas de cada host (ex: 192.168.1.1: 22,80,443)")
+	fmt.Println("  -greppable")
+	fmt.Println("        Uma linha por porta aberta: Host: <ip>\\tPort: <porta>/<proto>\\tState: <estado>\\tService: <serviço>\\tReason: <motivo>\\tRunID: <id>")
+	fmt.Println("  -greppable-closed")
+	fmt.Println("        Como -greppable, incluindo portas fechadas, filtradas e skipped")
+	fmt.Println("  -count-only")
+	fmt.Println("        Exibe apenas o número de portas abertas (um host: 3; vários: 192.168.1.1: 3)")
+	fmt.Println("  -n, -no-dns")
+	fmt.Println("        Não faz nenhuma resolução DNS; -host e -targets aceitam apenas IPs e redes CIDR")
+	fmt.Println("  -dns-server string")
+	fmt.Println("        Resolve os hosts por este servidor DNS em vez do resolver do sistema (ex: 8.8.8.8 ou 8.8.8.8:53)")
+	fmt.Println("  -resolve-ptr")
+	fmt.Println("        Consulta o nome reverso (PTR) de cada endereço antes do scan; respostas ficam em cache por IP")
+	fmt.Println("  -ptr-timeout duration")
+	fmt.Println("        Tempo máximo de cada consulta PTR (default 2s)")
+	fmt.Println("  -ptr-threads int")
+	fmt.Println("        Consultas PTR simultâneas (default 20)")
+	fmt.Println("  -resolve-all")
+	fmt.Println("        Exibe todos os endereços IPv4/IPv6 para os quais o host resolve")
+	fmt.Println("  -all-addrs")
+	fmt.Println("        Escaneia todos os endereços resolvidos (DNS round-robin, CDNs)")
+	fmt.Println("  -dual")
+	fmt.Println("        Escaneia os endereços IPv4 e IPv6 do host separadamente")
+	fmt.Println("  -selftest")
+	fmt.Println("        Verifica o scanner contra um listener local e encerra (não requer -host)")
+	fmt.Println("  -listen-check")
+	fmt.Println("        Apenas local: tenta abrir cada porta de -p nesta máquina e lista as livres e em uso (não requer -host)")
+	fmt.Println("  -skip-offline")
+	fmt.Println("        Não escaneia hosts que parecem offline (ignorado com -Pn)")
+	fmt.Println("  -config string")
+	fmt.Println("        Arquivo de configuração com valores padrão (chave = valor)")
+	fmt.Println("  -V, -version")
+	fmt.Println("        Exibe a versão e informações de build")
+	fmt.Println("  -print-schema")
+	fmt.Println("        Exibe o JSON Schema do relatório do -json, gerado das tags dos tipos de resultado")
 	fmt.Println("  -h, -help")
 	fmt.Println("        Exibe esta mensagem de ajuda")
+	fmt.Println("\nVARIÁVEIS DE AMBIENTE:")
+	fmt.Println("  Toda opção pode ter seu valor padrão definido por ARGOS_<OPÇÃO>")
+	fmt.Println("  (ex: ARGOS_PORTS, ARGOS_THREADS, ARGOS_TIMEOUT, ARGOS_TOP_PORTS).")
+	fmt.Println("  Precedência: linha de comando > ambiente > arquivo -config > padrão")
 	fmt.Println("\nEXEMPLOS:")
-	fmt.Println("  go run argos.go -host example.com")
-	fmt.Println("  go run argos.go -host 192.168.1.1 -p 22,80,443 -t 50 -timeout 1000")
-	fmt.Println("  go run argos.go -host scanme.nmap.org -p 1-1000 -v")
-	fmt.Println("  go run argos.go -host 10.10.10.1 -Pn -p 1-65535")
+	fmt.Println("  go run . -host example.com")
+	fmt.Println("  go run . -host 192.168.1.1 -p 22,80,443 -t 50 -timeout 1000")
+	fmt.Println("  go run . -host scanme.nmap.org -p 1-1000 -v")
+	fmt.Println("  go run . -host 192.168.1.1 -p ssh,http,8000-8100")
+	fmt.Println("  go run . -host 10.10.10.1 -Pn -p 1-65535")
+	fmt.Println("  go run . -host app1.example.com,app2.example.com -p 80,443")
+	fmt.Println("  go run . -config argos.conf -p 22,80")
+	fmt.Println("  ARGOS_THREADS=200 ARGOS_TIMEOUT=1000 go run . -host example.com")
+	fmt.Println("  go run . -host 192.168.1.10 -watch 443 -interval 10")
+	fmt.Println("  go run . -host 10.0.0.5 -p 1-1024 -expect ssh,http,https")
+	fmt.Println("  go run . -host example.com -format '{{.Port}} {{.Service}}'")
+	os.Exit(0)
+}
+
+func envName(name string) string {
+	return "ARGOS_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// applyEnvDefaults percorre as opções em ordem fixa, cada uma com suas
+// variáveis (a do nome da opção primeiro, depois a do apelido). Se
+// ARGOS_PORTS e ARGOS_P vierem com valores diferentes, é erro: não há como
+// saber qual delas o usuário quis.
+func applyEnvDefaults() error {
+	envs := make(map[string][]string)
+	flag.VisitAll(func(f *flag.Flag) {
+		if f.Name != "config" {
+			envs[f.Name] = []string{envName(f.Name)}
+		}
+	})
+	aliases := make([]string, 0, len(configAliases))
+	for alias := range configAliases {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		name := configAliases[alias]
+		envs[name] = append(envs[name], envName(alias))
+	}
+
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		if err != nil {
+			return
+		}
+		var from, value string
+		for _, env := range envs[f.Name] {
+			v, ok := os.LookupEnv(env)
+			if !ok {
+				continue
+			}
+			if from != "" && v != value {
+				err = fmt.Errorf("%s e %s definem valores diferentes", from, env)
+				return
+			}
+			from, value = env, v
+		}
+		if from == "" {
+			return
+		}
+		if setErr := flag.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("valor inválido em %s: %v", from, setErr)
+		}
+	})
+
+	return err
+}
+
+func showVersion() {
+	fmt.Printf("Argos %s\n", version)
+	fmt.Printf("Go: %s (%s/%s)\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		settings := make(map[string]string)
+		for _, setting := range info.Settings {
+			settings[setting.Key] = setting.Value
+		}
+		if revision := settings["vcs.revision"]; revision != "" {
+			if settings["vcs.modified"] == "true" {
+				revision += " (modificado)"
+			}
+			fmt.Println("Commit:", revision)
+		}
+		if buildTime := settings["vcs.time"]; buildTime != "" {
+			fmt.Println("Data:", buildTime)
+		}
+	}
 	os.Exit(0)
 }
 
+func printSchema() {
+	schema := jsonSchema(reflect.TypeOf(JSONReport{}))
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = "Relatório -json do Argos " + version
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Erro ao gerar o schema:", err)
+		os.Exit(1)
+	}
+	fmt.Println(string(data))
+}
+
+// jsonSchema descreve o tipo como encoding/json o serializa, lendo as tags
+// json dos campos: assim o schema acompanha PortResult e os demais tipos do
+// relatório sem manutenção à parte. Campos sem omitempty são obrigatórios,
+// e slices e mapas sem omitempty também aceitam null, como o nil é gravado.
+func jsonSchema(t reflect.Type) map[string]any {
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == reflect.TypeOf(time.Duration(0)):
+		return map[string]any{"type": "integer", "description": "nanossegundos"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return jsonSchema(t.Elem())
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": jsonSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": jsonSchema(t.Elem())}
+	case reflect.Struct:
+		properties := make(map[string]any)
+		required := []string{}
+		addStructFields(t, properties, &required)
+		return map[string]any{"type": "object", "properties": properties, "required": required}
+	}
+	return map[string]any{}
+}
+
+func addStructFields(t reflect.Type, properties map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if field.Anonymous && tag == "" {
+			addStructFields(field.Type, properties, required)
+			continue
+		}
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		schema := jsonSchema(field.Type)
+		omitempty := strings.Contains(options, "omitempty")
+		if !omitempty {
+			*required = append(*required, name)
+			if kind := field.Type.Kind(); kind == reflect.Slice || kind == reflect.Map {
+				schema["type"] = []string{schema["type"].(string), "null"}
+			}
+		}
+		properties[name] = schema
+	}
+}
+
+// expandPortShortcut aceita o -p- do nmap, que o pacote flag leria como um
+// flag chamado "p-", trocando-o pelo range completo.
+func expandPortShortcut(args []string) []string {
+	expanded := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "-p-" || arg == "--p-" {
+			arg = "-p=1-65535"
+		}
+		expanded[i] = arg
+	}
+	return expanded
+}
+
+// estimateScanTime é o limite superior da duração do scan: todas as portas
+// expiram, com todas as novas tentativas, em lotes de -t conexões ou no ritmo
+// do -rate, o que for mais lento, limitado pelo -host-timeout de cada host.
+func estimateScanTime(hosts, ports int, opts ScanOptions) time.Duration {
+	attempts := 1 + max(opts.Retries, opts.ResetRetries)
+	batches := (ports + opts.Threads - 1) / opts.Threads
+	perHost := time.Duration(batches*attempts) * opts.Timeout
+	if opts.Rate > 0 {
+		perHost = max(perHost, time.Duration(ports*attempts)*time.Second/time.Duration(opts.Rate))
+	}
+	if opts.HostTimeout > 0 {
+		perHost = min(perHost, opts.HostTimeout)
+	}
+	return time.Duration(hosts) * perHost
+}
+
+// confirm pergunta sim/não na saída de erro, para não misturar a pergunta a
+// saídas como -json. Só faz sentido com um terminal na entrada.
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [s/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "s", "sim", "y", "yes":
+		return true
+	}
+	return false
+}
+
+// readHost lê uma linha do prompt de host, sem os espaços das pontas, e a
+// valida como o -host seria validado. Devolve io.EOF se a entrada acabar
+// antes de qualquer texto; uma última linha sem quebra ainda vale.
+func readHost(in *bufio.Reader) (string, error) {
+	line, err := in.ReadString('\n')
+	line = strings.TrimSpace(line)
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	if line == "" {
+		return "", fmt.Errorf("nenhum host informado")
+	}
+	for _, part := range strings.Split(line, ",") {
+		if part = strings.TrimSpace(part); strings.ContainsAny(part, " \t") {
+			return "", fmt.Errorf("host inválido %q: separe vários hosts com vírgula", part)
+		}
+	}
+	if _, err := expandTargets(line); err != nil {
+		return "", err
+	}
+	return line, nil
+}
+
+func findConfigArg(args []string) string {
+	for i, arg := range args {
+		name := strings.TrimLeft(arg, "-")
+		if name == arg {
+			continue
+		}
+		if name == "config" && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(name, "config=") {
+			return strings.TrimPrefix(name, "config=")
+		}
+	}
+	return ""
+}
+
+// configEntry é uma linha chave = valor do -config; a ordem do arquivo é
+// mantida para que, entre uma opção e seu apelido (ports e p), vença a última.
+type configEntry struct {
+	Key   string
+	Value string
+}
+
+func loadConfigFile(path string) ([]configEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("não foi possível abrir o arquivo de configuração %s: %v", path, err)
+	}
+	defer file.Close()
+
+	var entries []configEntry
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "[") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%s:%d: linha inválida, esperado chave = valor", path, lineNum)
+		}
+
+		key := strings.TrimSpace(parts[0])
+		value := strings.Trim(strings.TrimSpace(parts[1]), "\"'")
+		entries = append(entries, configEntry{Key: key, Value: value})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("erro ao ler %s: %v", path, err)
+	}
+
+	return entries, nil
+}
+
+func applyConfigFile(path string) error {
+	entries, err := loadConfigFile(path)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name := entry.Key
+		if alias, ok := configAliases[entry.Key]; ok {
+			name = alias
+		}
+		if name == "config" || flag.Lookup(name) == nil {
+			return fmt.Errorf("opção desconhecida no arquivo de configuração: %s", entry.Key)
+		}
+		if err := flag.Set(name, entry.Value); err != nil {
+			return fmt.Errorf("valor inválido para %s no arquivo de configuração: %v", entry.Key, err)
+		}
+	}
+
+	return nil
+}
+
+func servicePort(name string) (int, bool) {
+	for port, service := range commonPorts {
+		if strings.EqualFold(service, name) {
+			return port, true
+		}
+	}
+	return 0, false
+}
+
+func knownServiceNames() []string {
+	names := make([]string, 0, len(commonPorts))
+	for _, service := range commonPorts {
+		names = append(names, strings.ToLower(service))
+	}
+	sort.Strings(names)
+	return names
+}
+
 func parsePortRange(portRange string) ([]int, error) {
 	var ports []int
 
@@ -88,6 +1116,15 @@ func parsePortRange(portRange string) ([]int, error) {
 	ranges := strings.Split(portRange, ",")
 	for _, r := range ranges {
 		r = strings.TrimSpace(r)
+		if port, ok := servicePort(r); ok {
+			ports = append(ports, port)
+			continue
+		}
+
+		if strings.IndexFunc(r, unicode.IsLetter) >= 0 {
+			return nil, fmt.Errorf("serviço desconhecido: %s (conhecidos: %s)", r, strings.Join(knownServiceNames(), ", "))
+		}
+
 		if strings.Contains(r, "-") {
 			parts := strings.Split(r, "-")
 			if len(parts) != 2 {
@@ -123,221 +1160,4126 @@ func parsePortRange(portRange string) ([]int, error) {
 	return ports, nil
 }
 
-func validateHost(host string) (string, error) {
-	ips, err := net.LookupIP(host)
-	if err != nil {
-		return "", fmt.Errorf("não foi possível resolver o host %s: %v", host, err)
+func expandTargets(hostSpec string) ([]string, error) {
+	var hosts []string
+	for _, h := range strings.Split(hostSpec, ",") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		specs, err := expandOctetRanges(h)
+		if err != nil {
+			return nil, err
+		}
+		for _, spec := range specs {
+			if !strings.Contains(spec, "/") {
+				hosts = append(hosts, spec)
+				continue
+			}
+			prefix, err := netip.ParsePrefix(spec)
+			if err != nil {
+				return nil, fmt.Errorf("rede inválida: %s", spec)
+			}
+			addrs, err := expandCIDR(prefix)
+			if err != nil {
+				return nil, err
+			}
+			hosts = append(hosts, addrs...)
+		}
+		if len(hosts) > 1<<maxCIDRBits {
+			return nil, fmt.Errorf("alvos demais (máximo de %d endereços)", 1<<maxCIDRBits)
+		}
 	}
+	return hosts, nil
+}
 
-	for _, ip := range ips {
-		if ipv4 := ip.To4(); ipv4 != nil {
-			return ipv4.String(), nil
+// expandOctetRanges expande intervalos por octeto no estilo do nmap
+// (192.168.1.1-254, 10.0.1-3.0/24). Qualquer outra especificação, inclusive
+// hostnames com hífen, é devolvida sem alteração.
+func expandOctetRanges(spec string) ([]string, error) {
+	addr, suffix := spec, ""
+	if i := strings.Index(spec, "/"); i >= 0 {
+		addr, suffix = spec[:i], spec[i:]
+	}
+	parts := strings.Split(addr, ".")
+	if len(parts) != 4 || !strings.Contains(addr, "-") {
+		return []string{spec}, nil
+	}
+
+	var bounds [4][2]int
+	for i, part := range parts {
+		first, last, isRange := strings.Cut(part, "-")
+		if !isRange {
+			last = first
+		}
+		lo, err1 := strconv.Atoi(first)
+		hi, err2 := strconv.Atoi(last)
+		if err1 != nil || err2 != nil {
+			return []string{spec}, nil
+		}
+		if lo < 0 || hi > 255 || lo > hi {
+			return nil, fmt.Errorf("intervalo de octeto inválido em %s: %s", spec, part)
 		}
+		bounds[i] = [2]int{lo, hi}
 	}
 
-	if len(ips) > 0 {
-		return ips[0].String(), nil
+	total := 1
+	for _, b := range bounds {
+		total *= b[1] - b[0] + 1
+	}
+	if total > 1<<maxCIDRBits {
+		return nil, fmt.Errorf("intervalo %s grande demais (máximo de %d endereços)", spec, 1<<maxCIDRBits)
 	}
 
-	return "", fmt.Errorf("nenhum endereço IP encontrado para %s", host)
+	specs := make([]string, 0, total)
+	for a := bounds[0][0]; a <= bounds[0][1]; a++ {
+		for b := bounds[1][0]; b <= bounds[1][1]; b++ {
+			for c := bounds[2][0]; c <= bounds[2][1]; c++ {
+				for d := bounds[3][0]; d <= bounds[3][1]; d++ {
+					specs = append(specs, fmt.Sprintf("%d.%d.%d.%d%s", a, b, c, d, suffix))
+				}
+			}
+		}
+	}
+	return specs, nil
 }
 
-func scanPort(host string, port int, timeout time.Duration) PortResult {
-	result := PortResult{
-		Port:    port,
-		State:   "closed",
-		Service: "unknown",
+// expandCIDR lista os endereços de uma rede. Em redes IPv4 maiores que /31
+// os endereços de rede e broadcast ficam de fora.
+func expandCIDR(prefix netip.Prefix) ([]string, error) {
+	prefix = prefix.Masked()
+	hostBits := prefix.Addr().BitLen() - prefix.Bits()
+	if hostBits > maxCIDRBits {
+		return nil, fmt.Errorf("rede %s grande demais (máximo de %d endereços)", prefix, 1<<maxCIDRBits)
 	}
 
-	address := fmt.Sprintf("%s:%d", host, port)
+	var addrs []string
+	for addr := prefix.Addr(); addr.IsValid() && prefix.Contains(addr); addr = addr.Next() {
+		addrs = append(addrs, addr.String())
+	}
+	if prefix.Addr().Is4() && hostBits >= 2 {
+		addrs = addrs[1 : len(addrs)-1]
+	}
+	return addrs, nil
+}
 
-	d := net.Dialer{Timeout: timeout}
-	conn, err := d.Dial("tcp", address)
+func parseExclusions(spec string) ([]netip.Prefix, error) {
+	var excluded []netip.Prefix
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if strings.Contains(item, "/") {
+			prefix, err := netip.ParsePrefix(item)
+			if err != nil {
+				return nil, fmt.Errorf("rede inválida: %s", item)
+			}
+			excluded = append(excluded, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(item)
+		if err != nil {
+			return nil, fmt.Errorf("endereço inválido: %s", item)
+		}
+		excluded = append(excluded, netip.PrefixFrom(addr.WithZone(""), addr.BitLen()))
+	}
+	return excluded, nil
+}
+
+func excludeTargets(targets []ScanTarget, excluded []netip.Prefix) ([]ScanTarget, int) {
+	kept := targets[:0]
+	removed := 0
+	for _, t := range targets {
+		literal, _ := splitZone(t.IP)
+		addr, err := netip.ParseAddr(literal)
+		skip := false
+		for _, prefix := range excluded {
+			if err == nil && prefix.Contains(addr.Unmap()) {
+				skip = true
+				break
+			}
+		}
+		if skip {
+			removed++
+			continue
+		}
+		kept = append(kept, t)
+	}
+	return kept, removed
+}
+
+func resolveTargets(hosts []string, opts ResolveOptions) []ScanTarget {
+	var targets []ScanTarget
+	byIP := make(map[string]int)
+
+	for _, host := range hosts {
+		ips, err := validateHost(host)
+		if err != nil {
+			warnf("Erro: %v\n", err)
+			continue
+		}
+
+		if opts.ShowAll {
+			logf("%s resolve para %d endereço(s):\n", host, len(ips))
+			for _, ip := range ips {
+				logf("  %s\t%s\n", ip, ipFamily(ip))
+			}
+		}
+
+		if opts.Family != "" {
+			if ips = filterFamily(ips, opts.Family); len(ips) == 0 {
+				warnf("Erro: %s não possui endereço %s\n", host, opts.Family)
+				continue
+			}
+		}
+
+		var hostTargets []ScanTarget
+		if opts.AllAddrs {
+			hostTargets = allTargets(ips)
+		} else {
+			hostTargets = selectTargets(ips, opts.Dual)
+		}
+		if opts.Dual && len(hostTargets) == 1 {
+			warnf("Aviso: %s possui apenas endereço %s, modo dual-stack indisponível.\n", host, hostTargets[0].Family)
+		}
+		if _, zone := splitZone(host); zone != "" {
+			for i := range hostTargets {
+				hostTargets[i].IP += "%" + zone
+			}
+		}
+		if !opts.Dual && !opts.AllAddrs && opts.PreferIPv4 && opts.Family == "" && hostTargets[0].Family == "IPv6" {
+			logf("Forçando uso de IPv4, mas apenas endereço IPv6 disponível para %s. Usando %s\n", host, hostTargets[0].IP)
+		}
+
+		for _, t := range hostTargets {
+			if i, ok := byIP[t.IP]; ok {
+				targets[i].Names = append(targets[i].Names, host)
+				continue
+			}
+			t.Names = []string{host}
+			byIP[t.IP] = len(targets)
+			targets = append(targets, t)
+		}
+	}
+
+	return targets
+}
+
+func loadNmapServices(path string) ([]int, error) {
+	if ports, ok := servicesFileCache[path]; ok {
+		return ports, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("não foi possível abrir o arquivo de serviços %s: %v", path, err)
+	}
+	defer file.Close()
+
+	type rankedPort struct {
+		port      int
+		frequency float64
+	}
+
+	var entries []rankedPort
+	seen := make(map[int]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 3 || !strings.HasSuffix(fields[1], "/tcp") {
+			continue
+		}
+
+		port, err := strconv.Atoi(strings.TrimSuffix(fields[1], "/tcp"))
+		if err != nil || seen[port] {
+			continue
+		}
+
+		frequency, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			continue
+		}
+
+		seen[port] = true
+		entries = append(entries, rankedPort{port: port, frequency: frequency})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("erro ao ler %s: %v", path, err)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].frequency > entries[j].frequency
+	})
+
+	ports := make([]int, len(entries))
+	for i, e := range entries {
+		ports[i] = e.port
+	}
+
+	servicesFileCache[path] = ports
+	return ports, nil
+}
+
+// orderByFrequency reordena ports, no lugar, pela posição de cada uma em
+// ranked; portas fora do ranking vão para o fim, na ordem em que estavam.
+func orderByFrequency(ports, ranked []int) {
+	rank := make(map[int]int, len(ranked))
+	for i, p := range ranked {
+		rank[p] = i
+	}
+	sort.SliceStable(ports, func(i, j int) bool {
+		ri, okI := rank[ports[i]]
+		rj, okJ := rank[ports[j]]
+		if okI != okJ {
+			return okI
+		}
+		return okI && ri < rj
+	})
+}
+
+func topPorts(n int, servicesFile string) ([]int, error) {
+	ranked := builtinTopPorts
+	if servicesFile != "" {
+		loaded, err := loadNmapServices(servicesFile)
+		if err != nil {
+			return nil, err
+		}
+		ranked = loaded
+	}
+
+	if n > len(ranked) {
+		n = len(ranked)
+	}
+
+	ports := make([]int, n)
+	copy(ports, ranked[:n])
+	return ports, nil
+}
+
+func isTemporaryDNSError(err error) bool {
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) || dnsErr.IsNotFound {
+		return false
+	}
+	return dnsErr.IsTemporary || dnsErr.IsTimeout
+}
+
+// splitZone separa o identificador de zona de um IPv6 link-local
+// (fe80::1%eth0). O zone é descartado pelo LookupIP e precisa ser
+// reanexado ao endereço de cada alvo para que o dial use a interface certa.
+func splitZone(host string) (string, string) {
+	if i := strings.LastIndex(host, "%"); i >= 0 && strings.Contains(host, ":") {
+		return host[:i], host[i+1:]
+	}
+	return host, ""
+}
+
+// resolver atende todas as resoluções de nomes; -dns-server o troca por um
+// que consulta apenas o servidor informado.
+var resolver = net.DefaultResolver
+
+// noDNS (-n/-no-dns) desliga qualquer resolução: só IPs literais são aceitos.
+var noDNS bool
+
+func newResolver(server string) *net.Resolver {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// errProxyAuth indica que o proxy HTTP recusou as credenciais (407).
+var errProxyAuth = errors.New("proxy exige autenticação (407)")
+
+// proxyConn preserva o que o bufio.Reader já leu além da resposta do CONNECT,
+// que pode incluir o início do banner do serviço.
+type proxyConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *proxyConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// httpProxyDialer devolve um Dial que abre um túnel HTTP CONNECT até cada
+// destino. O proxy não repassa RST nem silêncio, então 504 é tratado como
+// timeout (filtered) e os demais erros 5xx como conexão recusada (closed).
+func httpProxyDialer(proxy, auth string, timeout time.Duration) func(ctx context.Context, network, address string) (net.Conn, error) {
+	var authHeader string
+	if auth != "" {
+		authHeader = "Proxy-Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(auth)) + "\r\n"
+	}
+	return func(ctx context.Context, _, address string) (net.Conn, error) {
+		d := net.Dialer{Timeout: timeout}
+		conn, err := d.DialContext(ctx, "tcp", proxy)
+		if err != nil {
+			return nil, fmt.Errorf("proxy %s inacessível: %v", proxy, err)
+		}
+		conn.SetDeadline(time.Now().Add(timeout))
+		fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n%s\r\n", address, address, authHeader)
+		r := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(r, &http.Request{Method: http.MethodConnect})
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		resp.Body.Close()
+		switch {
+		case resp.StatusCode == http.StatusOK:
+			conn.SetDeadline(time.Time{})
+			return &proxyConn{Conn: conn, r: r}, nil
+		case resp.StatusCode == http.StatusProxyAuthRequired:
+			conn.Close()
+			return nil, errProxyAuth
+		case resp.StatusCode == http.StatusGatewayTimeout:
+			conn.Close()
+			return nil, os.ErrDeadlineExceeded
+		default:
+			conn.Close()
+			return nil, fmt.Errorf("proxy respondeu %s: %w", resp.Status, syscall.ECONNREFUSED)
+		}
+	}
+}
+
+// ptrCache guarda a resposta PTR de cada IP, inclusive a ausência de nome,
+// para que o mesmo endereço não seja consultado de novo. A chave é o IP sem
+// zona: fe80::1%eth0 e fe80::1%eth1 têm o mesmo nome reverso.
+type ptrCache struct {
+	mu    sync.Mutex
+	names map[string]string
+}
+
+var ptrNames = &ptrCache{names: make(map[string]string)}
+
+func (c *ptrCache) lookup(ip string, timeout time.Duration) string {
+	literal, _ := splitZone(ip)
+	c.mu.Lock()
+	name, ok := c.names[literal]
+	c.mu.Unlock()
+	if ok {
+		return name
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if names, err := resolver.LookupAddr(ctx, literal); err == nil && len(names) > 0 {
+		name = strings.TrimSuffix(names[0], ".")
+	}
+
+	c.mu.Lock()
+	c.names[literal] = name
+	c.mu.Unlock()
+	return name
+}
+
+// resolvePTRs faz as consultas reversas de todos os alvos antes do scan, com
+// concorrência e timeout próprios para não inflar varreduras de redes inteiras.
+func resolvePTRs(targets []ScanTarget, threads int, timeout time.Duration) int {
+	// Os alvos já são únicos por IP, mas zonas diferentes do mesmo endereço
+	// compartilham uma só consulta.
+	byLiteral := make(map[string][]*ScanTarget)
+	var literals []string
+	for i := range targets {
+		literal, _ := splitZone(targets[i].IP)
+		if _, ok := byLiteral[literal]; !ok {
+			literals = append(literals, literal)
+		}
+		byLiteral[literal] = append(byLiteral[literal], &targets[i])
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, threads)
+	for _, literal := range literals {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(literal string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			name := ptrNames.lookup(literal, timeout)
+			for _, t := range byLiteral[literal] {
+				t.PTR = name
+			}
+		}(literal)
+	}
+	wg.Wait()
+
+	found := 0
+	for _, t := range targets {
+		if t.PTR != "" {
+			found++
+		}
+	}
+	return found
+}
+
+// sshJumpDialer conecta ao bastion com autenticação por chave, conferindo a
+// chave do servidor contra o known_hosts, e devolve um Dial que abre cada
+// conexão de scan como um canal direct-tcpip a partir do bastion.
+func sshJumpDialer(jump, keyPath, knownHostsPath string, timeout time.Duration) (func(ctx context.Context, network, address string) (net.Conn, error), *ssh.Client, error) {
+	user, host, ok := strings.Cut(jump, "@")
+	if !ok || user == "" || host == "" {
+		return nil, nil, fmt.Errorf("use o formato usuário@host[:porta]")
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "22")
+	}
+
+	key, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("não foi possível ler a chave %s: %v", keyPath, err)
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("chave %s inválida: %v", keyPath, err)
+	}
+	hostKeys, err := knownhosts.New(knownHostsPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("não foi possível ler o known_hosts %s: %v", knownHostsPath, err)
+	}
+
+	client, err := ssh.Dial("tcp", host, &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeys,
+		Timeout:         timeout,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		conn, err := client.DialContext(ctx, network, address)
+		var openErr *ssh.OpenChannelError
+		if errors.As(err, &openErr) {
+			// O bastion só devolve a mensagem do connect(2) que ele fez.
+			msg := strings.ToLower(openErr.Message)
+			switch {
+			case strings.Contains(msg, "refused"):
+				return nil, fmt.Errorf("bastion: %s: %w", openErr.Message, syscall.ECONNREFUSED)
+			case strings.Contains(msg, "timed out"):
+				return nil, os.ErrDeadlineExceeded
+			case strings.Contains(msg, "no route"):
+				return nil, fmt.Errorf("bastion: %s: %w", openErr.Message, syscall.EHOSTUNREACH)
+			}
+		}
+		return conn, err
+	}
+	return dial, client, nil
+}
+
+// defaultSSHPath devolve ~/.ssh/<name>, ou o primeiro que existir entre os
+// nomes informados.
+func defaultSSHPath(names ...string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	for _, name := range names {
+		path := filepath.Join(home, ".ssh", name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join(home, ".ssh", names[0])
+}
+
+func lookupIP(host string) ([]net.IP, error) {
+	if noDNS {
+		literal, _ := splitZone(host)
+		ip := net.ParseIP(literal)
+		if ip == nil {
+			return nil, fmt.Errorf("%s não é um IP literal (-no-dns ativo)", host)
+		}
+		return []net.IP{ip}, nil
+	}
+	addrs, err := resolver.LookupIPAddr(context.Background(), host)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, addr := range addrs {
+		ips[i] = addr.IP
+	}
+	return ips, nil
+}
+
+func validateHost(host string) ([]net.IP, error) {
+	if _, zone := splitZone(host); zone != "" {
+		if _, err := strconv.Atoi(zone); err != nil {
+			if _, err := net.InterfaceByName(zone); err != nil {
+				return nil, fmt.Errorf("interface %s inválida para %s: %v", zone, host, err)
+			}
+		}
+	}
+
+	ips, err := lookupIP(host)
+	backoff := dnsRetryBackoff
+	for attempt := 1; attempt <= dnsRetries && err != nil && isTemporaryDNSError(err); attempt++ {
+		logf("Falha temporária ao resolver %s, tentando novamente em %s...\n", host, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+		ips, err = lookupIP(host)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("não foi possível resolver o host %s: %v", host, err)
+	}
+
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("nenhum endereço IP encontrado para %s", host)
+	}
+
+	return ips, nil
+}
+
+func ipFamily(ip net.IP) string {
+	if ip.To4() != nil {
+		return "IPv4"
+	}
+	return "IPv6"
+}
+
+func firstOfFamily(ips []net.IP, family string) net.IP {
+	for _, ip := range ips {
+		if ipFamily(ip) == family {
+			return ip
+		}
+	}
+	return nil
+}
+
+func filterFamily(ips []net.IP, family string) []net.IP {
+	var kept []net.IP
+	for _, ip := range ips {
+		if ipFamily(ip) == family {
+			kept = append(kept, ip)
+		}
+	}
+	return kept
+}
+
+func allTargets(ips []net.IP) []ScanTarget {
+	var targets []ScanTarget
+	for _, ip := range ips {
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		targets = append(targets, ScanTarget{IP: ip.String(), Family: ipFamily(ip)})
+	}
+	return targets
+}
+
+func selectTargets(ips []net.IP, dual bool) []ScanTarget {
+	var targets []ScanTarget
+
+	ipv4 := firstOfFamily(ips, "IPv4")
+	ipv6 := firstOfFamily(ips, "IPv6")
+
+	if ipv4 != nil {
+		targets = append(targets, ScanTarget{IP: ipv4.To4().String(), Family: "IPv4"})
+	}
+	if ipv6 != nil && (dual || ipv4 == nil) {
+		targets = append(targets, ScanTarget{IP: ipv6.String(), Family: "IPv6"})
+	}
+
+	return targets
+}
+
+// millisDuration aceita tanto durações Go (500ms, 2s) quanto um número puro,
+// lido em milissegundos para manter compatível o antigo -timeout 1000.
+type millisDuration time.Duration
+
+func (d *millisDuration) String() string {
+	return time.Duration(*d).String()
+}
+
+func (d *millisDuration) Set(value string) error {
+	if ms, err := strconv.Atoi(value); err == nil {
+		*d = millisDuration(time.Duration(ms) * time.Millisecond)
+		return nil
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("duração inválida: %s", value)
+	}
+	*d = millisDuration(parsed)
+	return nil
+}
+
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
+
+type retryBudget struct {
+	remaining int64
+}
+
+func newRetryBudget(n int) *retryBudget {
+	if n <= 0 {
+		return nil
+	}
+	return &retryBudget{remaining: int64(n)}
+}
+
+func (b *retryBudget) take() bool {
+	if b == nil {
+		return true
+	}
+	return atomic.AddInt64(&b.remaining, -1) >= 0
+}
+
+var (
+	errHostUnreachable = errors.New("host inacessível")
+	errFoundOpen       = errors.New("porta aberta encontrada")
+	errMaxOpen         = errors.New("limite de portas abertas atingido")
+)
+
+func skipReason(ctx context.Context) string {
+	switch cause := context.Cause(ctx); {
+	case errors.Is(cause, errHostUnreachable):
+		return "host-unreachable"
+	case errors.Is(cause, errFoundOpen):
+		return "fail-fast"
+	case errors.Is(cause, errMaxOpen):
+		return "max-open"
+	case errors.Is(cause, context.DeadlineExceeded):
+		return "host-timeout"
+	}
+	return "cancelled"
+}
+
+func dialReason(err error) string {
+	if err == nil {
+		return "syn-ack"
+	}
+	if isTimeout(err) {
+		return "no-response"
+	}
+
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "conn-refused"
+	case errors.Is(err, syscall.EHOSTUNREACH):
+		return "host-unreach"
+	case errors.Is(err, syscall.ENETUNREACH):
+		return "net-unreach"
+	case errors.Is(err, errProxyAuth):
+		return "proxy-auth"
+	}
+	return "error"
+}
+
+func closeConn(conn net.Conn, graceful bool) {
+	if tcpConn, ok := conn.(*net.TCPConn); ok && graceful {
+		tcpConn.CloseWrite()
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		io.Copy(io.Discard, io.LimitReader(conn, 64*1024))
+	}
+	conn.Close()
+}
+
+func readBanner(conn net.Conn, timeout time.Duration) (string, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		// Canais SSH do -ssh-jump não aceitam deadline; a leitura segue em
+		// segundo plano e termina quando a conexão é fechada.
+		return readBannerTimer(conn, timeout)
+	}
+	buff := make([]byte, 1024)
+	n, err := conn.Read(buff)
+	if err != nil {
+		return "", err
+	}
+	return string(buff[:n]), nil
+}
+
+func readBannerTimer(conn net.Conn, timeout time.Duration) (string, error) {
+	type read struct {
+		banner string
+		err    error
+	}
+	done := make(chan read, 1)
+	go func() {
+		buff := make([]byte, 1024)
+		n, err := conn.Read(buff)
+		done <- read{string(buff[:n]), err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.banner, r.err
+	case <-timer.C:
+		return "", os.ErrDeadlineExceeded
+	}
+}
+
+// serviceProbes são os probes de identificação, pelo nome usado em
+// -probe-order: cada um envia seu payload (nenhum, no caso de "read") e lê a
+// resposta na mesma conexão.
+var serviceProbes = map[string]string{
+	"read": "",
+	"http": "HEAD / HTTP/1.0\r\n\r\n",
+	"crlf": "\r\n",
+}
+
+// O scan normal só lê o banner, para não gastar um segundo probe em cada porta
+// silenciosa; o -banner-only também tenta HTTP. -probe-order substitui ambos.
+var (
+	scanProbeOrder   = []string{"read"}
+	bannerProbeOrder = []string{"read", "http"}
+)
+
+func parseProbeOrder(spec string) ([]string, error) {
+	var order []string
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if _, ok := serviceProbes[name]; !ok {
+			return nil, fmt.Errorf("probe desconhecido %q (disponíveis: read, http, crlf)", name)
+		}
+		order = append(order, name)
+	}
+	if len(order) == 0 {
+		return nil, fmt.Errorf("nenhum probe informado")
+	}
+	return order, nil
+}
+
+// runProbes tenta os probes de -probe-order, ou a ordem padrão do modo, e
+// devolve o primeiro que obtém resposta.
+func runProbes(conn net.Conn, defaults []string, opts ScanOptions) (string, string, error) {
+	order := opts.ProbeOrder
+	if len(order) == 0 {
+		order = defaults
+	}
+	var err error
+	for _, name := range order {
+		if payload := serviceProbes[name]; payload != "" {
+			if _, err = conn.Write([]byte(payload)); err != nil {
+				return "", "", err
+			}
+		}
+		var banner string
+		if banner, err = readBanner(conn, opts.probeTimeout()); err == nil {
+			return name, banner, nil
+		}
+	}
+	return "", "", err
+}
+
+func grabBanner(ip string, port int, opts ScanOptions) (string, error) {
+	dial := opts.Dial
+	if dial == nil {
+		d := net.Dialer{Timeout: opts.Timeout}
+		dial = d.DialContext
+	}
+	conn, err := dial(context.Background(), "tcp", net.JoinHostPort(ip, strconv.Itoa(port)))
+	if err != nil {
+		return "", err
+	}
+	defer closeConn(conn, opts.GracefulClose)
+
+	_, banner, err := runProbes(conn, bannerProbeOrder, opts)
+	return banner, err
+}
+
+func loadWordlist(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("não foi possível abrir a wordlist %s: %v", path, err)
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		word := strings.TrimSpace(scanner.Text())
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		if !strings.HasPrefix(word, "/") {
+			word = "/" + word
+		}
+		words = append(words, word)
+	}
+	return words, scanner.Err()
+}
+
+func isHTTPService(r PortResult) bool {
+	switch r.Service {
+	case "HTTP", "HTTPS", "HTTP-Proxy":
+		return true
+	}
+	return strings.HasPrefix(r.Banner, "HTTP/")
+}
+
+// newHostHTTPClient cria o cliente compartilhado pelas portas HTTP de um
+// mesmo host. O cache de sessões TLS permite retomar o handshake entre
+// portas e caminhos, e as conexões ociosas são reaproveitadas pelas threads.
+func newHostHTTPClient(opts ScanOptions) *http.Client {
+	return &http.Client{
+		Timeout: opts.Timeout * 4,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+				ClientSessionCache: tls.NewLRUClientSessionCache(0),
+			},
+			MaxIdleConnsPerHost: opts.Threads,
+			DialContext:         opts.Dial,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func probeHTTPPaths(client *http.Client, ip string, r PortResult, paths []string, opts ScanOptions) []HTTPPath {
+	scheme := "http"
+	if r.Service == "HTTPS" {
+		scheme = "https"
+	}
+	base := scheme + "://" + net.JoinHostPort(strings.Replace(ip, "%", "%25", 1), strconv.Itoa(r.Port))
+
+	statuses := make([]int, len(paths))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, opts.Threads)
+	for i, path := range paths {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, path string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			resp, err := client.Head(base + path)
+			if err != nil {
+				return
+			}
+			resp.Body.Close()
+			statuses[i] = resp.StatusCode
+		}(i, path)
+	}
+	wg.Wait()
+
+	var found []HTTPPath
+	for i, status := range statuses {
+		switch status {
+		case http.StatusOK, http.StatusMovedPermanently, http.StatusForbidden:
+			found = append(found, HTTPPath{Path: paths[i], Status: status})
+		}
+	}
+	return found
+}
+
+// verifyTLSHostnames faz um handshake TLS em cada porta aberta e confere o
+// certificado contra name. O handshake em si não valida nada, para que um
+// certificado ruim ainda seja lido e classificado; portas que não falam TLS
+// ficam sem TLSCheck.
+func verifyTLSHostnames(ip, name string, results []PortResult, opts ScanOptions) {
+	dial := opts.Dial
+	if dial == nil {
+		d := net.Dialer{Timeout: opts.Timeout}
+		dial = d.DialContext
+	}
+	serverName := name
+	if literal, _ := splitZone(name); net.ParseIP(literal) != nil {
+		serverName = ""
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, opts.Threads)
+	for i := range results {
+		if results[i].State != "open" {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(r *PortResult) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			conn, err := dial(context.Background(), "tcp", net.JoinHostPort(ip, strconv.Itoa(r.Port)))
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(opts.Timeout + opts.probeTimeout()))
+			client := tls.Client(conn, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+			if err := client.Handshake(); err != nil {
+				return
+			}
+			r.TLS = checkCertificate(client.ConnectionState().PeerCertificates, name, nil)
+		}(&results[i])
+	}
+	wg.Wait()
+}
+
+// checkCertificate valida a cadeia recebida contra roots (nil usa as raízes
+// do sistema) e o nome. Um nome divergente tem prioridade no diagnóstico:
+// é o sinal mais direto de que o certificado não é deste serviço.
+func checkCertificate(certs []*x509.Certificate, name string, roots *x509.CertPool) *TLSCheck {
+	check := &TLSCheck{Name: name}
+	if len(certs) == 0 {
+		check.Problem = "invalid"
+		return check
+	}
+	leaf := certs[0]
+	if literal, _ := splitZone(name); leaf.VerifyHostname(literal) != nil {
+		check.Problem = "hostname-mismatch"
+		return check
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+	var unknown x509.UnknownAuthorityError
+	var invalid x509.CertificateInvalidError
+	switch {
+	case err == nil:
+		check.Valid = true
+	case errors.As(err, &unknown) && isSelfSigned(leaf):
+		check.Problem = "self-signed"
+	case errors.As(err, &unknown):
+		check.Problem = "unknown-authority"
+	case errors.As(err, &invalid) && invalid.Reason == x509.Expired:
+		check.Problem = "expired"
+	default:
+		check.Problem = "invalid"
+	}
+	return check
+}
+
+// isSelfSigned confere a assinatura com a própria chave do certificado, sem
+// exigir que ele seja uma CA como CheckSignatureFrom faria.
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) &&
+		cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+type TargetPair struct {
+	Host string
+	Port int
+}
+
+func parseTargetPairs(list string) ([]TargetPair, error) {
+	var pairs []TargetPair
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		host, portStr, err := net.SplitHostPort(item)
+		if err != nil {
+			return nil, fmt.Errorf("alvo inválido %s (use host:porta)", item)
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			var ok bool
+			if port, ok = servicePort(portStr); !ok {
+				return nil, fmt.Errorf("porta inválida em %s", item)
+			}
+		}
+		if port < 1 || port > 65535 {
+			return nil, fmt.Errorf("porta fora do intervalo em %s", item)
+		}
+		pairs = append(pairs, TargetPair{Host: host, Port: port})
+	}
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("nenhum alvo informado")
+	}
+	return pairs, nil
+}
+
+// runTargetPairs verifica exatamente os pares host:porta do -targets, sem o
+// produto host × porta do scan normal.
+func runTargetPairs(pairs []TargetPair, opts ScanOptions) {
+	results := make([]PortResult, len(pairs))
+	addrs := make([]string, len(pairs))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, opts.Threads)
+	for i, pair := range pairs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, pair TargetPair) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			ips, err := validateHost(pair.Host)
+			if err != nil {
+				results[i] = PortResult{Port: pair.Port, State: "error", Service: "unknown", Reason: "dns"}
+				return
+			}
+			addrs[i] = selectTargets(ips, false)[0].IP
+			results[i] = scanPort(context.Background(), addrs[i], pair.Port, opts)
+		}(i, pair)
+	}
+	wg.Wait()
+
+	fmt.Println("\nALVO\tENDEREÇO\tESTADO\tSERVIÇO")
+	fmt.Println("----\t--------\t------\t-------")
+	for i, pair := range pairs {
+		fmt.Printf("%s\t%s\t%s\t%s\n", net.JoinHostPort(pair.Host, strconv.Itoa(pair.Port)), addrs[i], results[i].State, results[i].Service)
+	}
+}
+
+func runBannerOnly(ip string, ports []int, opts ScanOptions) {
+	banners := make([]string, len(ports))
+	errs := make([]error, len(ports))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, opts.Threads)
+	for i, port := range ports {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i, port int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			banners[i], errs[i] = grabBanner(ip, port, opts)
+		}(i, port)
+	}
+	wg.Wait()
+
+	for i, port := range ports {
+		switch {
+		case errs[i] != nil:
+			fmt.Printf("--- %s:%d (sem banner: %v) ---\n", ip, port, errs[i])
+		default:
+			fmt.Printf("--- %s:%d (%d bytes) ---\n", ip, port, len(banners[i]))
+			if bannerEncoding == "hex" {
+				fmt.Println(renderBanner(banners[i]))
+				continue
+			}
+			for _, line := range strings.Split(strings.TrimRight(banners[i], "\r\n"), "\n") {
+				fmt.Println(renderBanner(strings.TrimRight(line, "\r")))
+			}
+		}
+	}
+}
+
+// runListenCheck responde a outra pergunta que o scan: em vez de conectar a
+// um host, tenta net.Listen em cada porta desta máquina (todas as interfaces)
+// e informa quais estão livres para bind.
+func runListenCheck(ports []int, threads int) {
+	errs := make([]error, len(ports))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, threads)
+	for i, port := range ports {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i, port int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			ln, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			ln.Close()
+		}(i, port)
+	}
+	wg.Wait()
+
+	var free, inUse, denied, failed []int
+	for i, port := range ports {
+		switch {
+		case errs[i] == nil:
+			free = append(free, port)
+		case errors.Is(errs[i], syscall.EADDRINUSE):
+			inUse = append(inUse, port)
+		case errors.Is(errs[i], syscall.EACCES):
+			denied = append(denied, port)
+		default:
+			failed = append(failed, port)
+			warnf("Porta %d: %v\n", port, errs[i])
+		}
+	}
+
+	fmt.Println("Verificação local de bind (-listen-check), não é um scan remoto")
+	fmt.Printf("\nLivres: %d\n", len(free))
+	if len(free) > 0 {
+		fmt.Println(joinPorts(free))
+	}
+	fmt.Printf("\nEm uso: %d\n", len(inUse))
+	if len(inUse) > 0 {
+		fmt.Println(joinPorts(inUse))
+	}
+	if len(denied) > 0 {
+		fmt.Printf("\nSem permissão (portas privilegiadas exigem root): %d\n", len(denied))
+		fmt.Println(joinPorts(denied))
+	}
+	if len(failed) > 0 {
+		fmt.Printf("\nOutros erros: %d\n", len(failed))
+		fmt.Println(joinPorts(failed))
+	}
+}
+
+// scanPortSafe isola o worker de um pânico durante o scan de uma porta: ela
+// é marcada como "error" e as demais continuam.
+func scanPortSafe(ctx context.Context, host string, port int, opts ScanOptions) (result PortResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			warnLine("Erro: pânico ao escanear %s porta %d: %v", host, port, r)
+			result = PortResult{Port: port, State: "error", Service: "unknown", Reason: "panic"}
+		}
+	}()
+	if opts.Protocol == "sctp" {
+		return scanPortSCTP(host, port, opts.Timeout)
+	}
+	return scanPort(ctx, host, port, opts)
+}
+
+func scanPort(ctx context.Context, host string, port int, opts ScanOptions) PortResult {
+	result := PortResult{
+		Port:    port,
+		State:   "closed",
+		Service: "unknown",
+	}
+
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+
+	dial := opts.Dial
+	if dial == nil {
+		d := net.Dialer{Timeout: opts.Timeout}
+		dial = d.DialContext
+	}
+
+	var conn net.Conn
+	var err error
+	timeouts, resets := 0, 0
+	// Timing.Dial soma as novas tentativas; Latency mede só a última.
+	firstDial := time.Now()
+	for {
+		dialStart := time.Now()
+		conn, err = dial(ctx, "tcp", address)
+		result.Latency = time.Since(dialStart)
+
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+		if isTimeout(err) && timeouts < opts.Retries && opts.RetryBudget.take() {
+			timeouts++
+		} else if errors.Is(err, syscall.ECONNREFUSED) && resets < opts.ResetRetries && opts.RetryBudget.take() {
+			resets++
+		} else {
+			break
+		}
+		result.Retries++
+		if wait := retryPause(host, result.Retries, opts); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+			}
+		}
+	}
+	result.Reason = dialReason(err)
+
+	if err != nil && ctx.Err() != nil {
+		result.State = "skipped"
+		result.Reason = skipReason(ctx)
+		return result
+	}
+
+	if err == nil && conn != nil {
+		defer closeConn(conn, opts.GracefulClose)
+		result.State = "open"
+		if opts.ConfirmOf > 1 {
+			hits, probes := confirmOpen(ctx, dial, address, opts)
+			result.Confidence = fmt.Sprintf("%d/%d", hits, probes)
+			if hits < opts.ConfirmNeed {
+				result.State = "filtered"
+				result.Reason = "low-confidence"
+				return result
+			}
+		}
+		if opts.TimingDebug {
+			result.Timing = &PortTiming{Dial: time.Since(firstDial)}
+		}
+		if opts.TCPDetails {
+			result.TCP = readTCPDetails(conn)
+		}
+
+		if service, ok := commonPorts[port]; ok {
+			result.Service = service
+		}
+		if !opts.TwoPhase {
+			identifyService(conn, &result, opts)
+		}
+	} else if isTimeout(err) {
+		result.State = "filtered"
+	}
+
+	return result
+}
+
+func needsBanner(port int, opts ScanOptions) bool {
+	_, known := commonPorts[port]
+	return !known || opts.GrabBanners
+}
+
+// confirmOpen repete a conexão a uma porta que já aceitou uma vez até somar
+// opts.ConfirmNeed aceites em até opts.ConfirmOf tentativas, parando assim que
+// a votação estiver decidida. Filtra portas que aceitam de forma
+// intermitente, como atrás de balanceadores ou limitadores de taxa.
+func confirmOpen(ctx context.Context, dial func(ctx context.Context, network, address string) (net.Conn, error), address string, opts ScanOptions) (hits, probes int) {
+	hits, probes = 1, 1
+	for probes < opts.ConfirmOf && hits < opts.ConfirmNeed && hits+opts.ConfirmOf-probes >= opts.ConfirmNeed {
+		if ctx.Err() != nil {
+			break
+		}
+		probes++
+		if conn, err := dial(ctx, "tcp", address); err == nil {
+			hits++
+			closeConn(conn, opts.GracefulClose)
+		}
+	}
+	return hits, probes
+}
+
+// parseConfidence lê o -min-open-confidence no formato K/N: a porta só é
+// aberta se aceitar K de até N conexões.
+func parseConfidence(spec string) (need, of int, err error) {
+	needStr, ofStr, ok := strings.Cut(spec, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("use o formato K/N (ex: 2/3)")
+	}
+	need, err1 := strconv.Atoi(strings.TrimSpace(needStr))
+	of, err2 := strconv.Atoi(strings.TrimSpace(ofStr))
+	if err1 != nil || err2 != nil {
+		return 0, 0, fmt.Errorf("use o formato K/N (ex: 2/3)")
+	}
+	if need < 1 || of < need || of > maxConfirmProbes {
+		return 0, 0, fmt.Errorf("K/N exige 1 <= K <= N <= %d", maxConfirmProbes)
+	}
+	return need, of, nil
+}
+
+func identifyService(conn net.Conn, result *PortResult, opts ScanOptions) {
+	if !needsBanner(result.Port, opts) {
+		return
+	}
+	readStart := time.Now()
+	probe, banner, err := runProbes(conn, scanProbeOrder, opts)
+	if result.Timing != nil {
+		result.Timing.Banner = time.Since(readStart)
+	}
+	if err != nil {
+		return
+	}
+	result.Banner = banner
+	result.BannerHash = bannerHash(banner)
+	if _, known := commonPorts[result.Port]; !known {
+		if probe == "http" && strings.HasPrefix(banner, "HTTP/") {
+			result.Service = "HTTP"
+		} else {
+			result.Service = serviceHint(banner)
+		}
+	}
+}
+
+// grabOpenBanners é a segunda fase do -two-phase: reabre, em paralelo, só as
+// portas abertas que precisam de banner, depois que a descoberta terminou.
+func grabOpenBanners(ip string, results []PortResult, opts ScanOptions) int {
+	dial := opts.Dial
+	if dial == nil {
+		d := net.Dialer{Timeout: opts.Timeout}
+		dial = d.DialContext
+	}
+
+	probed := 0
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, opts.Threads)
+	for i := range results {
+		if results[i].State != "open" || !needsBanner(results[i].Port, opts) {
+			continue
+		}
+		probed++
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(r *PortResult) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			conn, err := dial(context.Background(), "tcp", net.JoinHostPort(ip, strconv.Itoa(r.Port)))
+			if err != nil {
+				return
+			}
+			defer closeConn(conn, opts.GracefulClose)
+			identifyService(conn, r, opts)
+		}(&results[i])
+	}
+	wg.Wait()
+	return probed
+}
+
+// mergeOpenResults leva para all (o HostScan.All) os banners e serviços que
+// grabOpenBanners gravou nas portas abertas de results.
+func mergeOpenResults(all, results []PortResult) {
+	byPort := make(map[int]PortResult, len(results))
+	for _, r := range results {
+		byPort[r.Port] = r
+	}
+	for i := range all {
+		if r, ok := byPort[all[i].Port]; ok && all[i].State == "open" {
+			all[i] = r
+		}
+	}
+}
+
+func sctpSockaddr(host string, port int) (int, syscall.Sockaddr, error) {
+	literal, zone := splitZone(host)
+	ip := net.ParseIP(literal)
+	if ip == nil {
+		return 0, nil, fmt.Errorf("endereço inválido para SCTP: %s", host)
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		addr := &syscall.SockaddrInet4{Port: port}
+		copy(addr.Addr[:], ip4)
+		return syscall.AF_INET, addr, nil
+	}
+
+	addr := &syscall.SockaddrInet6{Port: port}
+	copy(addr.Addr[:], ip.To16())
+	if zone != "" {
+		if ifi, err := net.InterfaceByName(zone); err == nil {
+			addr.ZoneId = uint32(ifi.Index)
+		} else if index, err := strconv.Atoi(zone); err == nil {
+			addr.ZoneId = uint32(index)
+		}
+	}
+	return syscall.AF_INET6, addr, nil
+}
+
+func checkSCTPSupport() error {
+	if _, ok := sendTimeoutOption[runtime.GOOS]; !ok {
+		return fmt.Errorf("scan SCTP não suportado em %s", runtime.GOOS)
+	}
+
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, ipprotoSCTP)
+	if err != nil {
+		return fmt.Errorf("SCTP indisponível neste sistema (módulo do kernel carregado?): %v", err)
+	}
+	syscall.Close(fd)
+	return nil
+}
+
+func scanPortSCTP(host string, port int, timeout time.Duration) PortResult {
+	result := PortResult{
+		Port:    port,
+		State:   "closed",
+		Service: "unknown",
+	}
+
+	domain, addr, err := sctpSockaddr(host, port)
+	if err != nil {
+		return result
+	}
+
+	fd, err := syscall.Socket(domain, syscall.SOCK_STREAM, ipprotoSCTP)
+	if err != nil {
+		return result
+	}
+	defer syscall.Close(fd)
+
+	tv := syscall.NsecToTimeval(timeout.Nanoseconds())
+	syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, sendTimeoutOption[runtime.GOOS], &tv)
+
+	dialStart := time.Now()
+	err = syscall.Connect(fd, addr)
+	result.Latency = time.Since(dialStart)
+
+	switch err {
+	case nil:
+		result.State = "open"
+		result.Reason = "init-ack"
+	case syscall.EINPROGRESS, syscall.EAGAIN, syscall.ETIMEDOUT:
+		result.State = "filtered"
+		result.Reason = "no-response"
+	case syscall.ECONNREFUSED:
+		result.Reason = "abort"
+	default:
+		result.Reason = dialReason(err)
+	}
+
+	return result
+}
+
+func watchPort(host, ip string, port int, opts ScanOptions, interval time.Duration) {
+	fmt.Printf("Monitorando %s (%s) porta %d a cada %s (Ctrl+C para parar)\n\n", host, ip, port, interval)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var checks, up int
+	var totalLatency time.Duration
+	startTime := time.Now()
+
+	for {
+		result := scanPort(context.Background(), ip, port, opts)
+		checks++
+		if result.State == "open" {
+			up++
+			totalLatency += result.Latency
+			fmt.Printf("[%s] porta %d: %s (%.1fms)\n", time.Now().Format("15:04:05"), port, result.State, float64(result.Latency)/float64(time.Millisecond))
+		} else {
+			fmt.Printf("[%s] porta %d: %s\n", time.Now().Format("15:04:05"), port, result.State)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-interrupt:
+			fmt.Printf("\n\nMonitoramento encerrado após %s\n", time.Since(startTime).Round(time.Second))
+			fmt.Printf("Verificações: %d, disponível: %d (%.1f%%)\n", checks, up, float64(up)/float64(checks)*100)
+			if up > 0 {
+				fmt.Printf("Latência média: %.1fms\n", float64(totalLatency)/float64(up)/float64(time.Millisecond))
+			}
+			return
+		}
+	}
+}
+
+func traceroute(ip string, port int, timeout time.Duration) ([]string, error) {
+	wait := strconv.Itoa(int(timeout.Seconds()) + 1)
+	args := []string{"-n", "-q", "1", "-w", wait, "-m", "30"}
+	if os.Geteuid() == 0 {
+		args = append(args, "-T", "-p", strconv.Itoa(port))
+	}
+	if strings.Contains(ip, ":") {
+		args = append(args, "-6")
+	}
+	args = append(args, ip)
+
+	out, err := exec.Command("traceroute", args...).Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var hops []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if strings.HasPrefix(line, "traceroute to") {
+			continue
+		}
+		hops = append(hops, strings.TrimSpace(line))
+	}
+	return hops, nil
+}
+
+func isLoopback(host string) bool {
+	addr, _ := splitZone(host)
+	ip := net.ParseIP(addr)
+	return ip != nil && ip.IsLoopback()
+}
+
+// isLocalNetwork indica loopback, redes privadas e link-local, onde uma
+// nova tentativa imediata é barata.
+func isLocalNetwork(host string) bool {
+	addr, _ := splitZone(host)
+	ip := net.ParseIP(addr)
+	return ip != nil && (ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast())
+}
+
+// retryPause é a espera antes da n-ésima nova tentativa: -retry-delay
+// multiplicado por -retry-backoff a cada tentativa. No modo automático, só
+// hosts fora da rede local esperam.
+func retryPause(host string, attempt int, opts ScanOptions) time.Duration {
+	base := opts.RetryDelay
+	if opts.RetryAuto {
+		if isLocalNetwork(host) {
+			return 0
+		}
+		base = autoRetryDelayWAN
+	}
+	if base <= 0 {
+		return 0
+	}
+	wait := float64(base) * math.Pow(opts.RetryBackoff, float64(attempt-1))
+	if wait > float64(maxRetryDelay) {
+		return maxRetryDelay
+	}
+	return time.Duration(wait)
+}
+
+// parseRetryDelay aceita "auto" ou uma duração, inclusive 0 para não esperar.
+func parseRetryDelay(value string) (delay time.Duration, auto bool, err error) {
+	if value == "auto" {
+		return 0, true, nil
+	}
+	delay, err = time.ParseDuration(value)
+	if err != nil {
+		return 0, false, fmt.Errorf("use auto ou uma duração (ex: 200ms, 1s)")
+	}
+	if delay < 0 || delay > maxRetryDelay {
+		return 0, false, fmt.Errorf("deve estar entre 0 e %s", maxRetryDelay)
+	}
+	return delay, false, nil
+}
+
+func isHostAlive(host string, ports []int, timeout time.Duration) bool {
+	loopback := isLoopback(host)
+	for _, port := range ports {
+		address := net.JoinHostPort(host, strconv.Itoa(port))
+		conn, err := net.DialTimeout("tcp", address, timeout)
+		if err == nil {
+			conn.Close()
+			return true
+		}
+		if loopback && errors.Is(err, syscall.ECONNREFUSED) {
+			return true
+		}
+	}
+
+	if loopback {
+		return false
+	}
+
+	cmd := exec.Command("ping", "-c", "1", "-W", "2", host)
+	err := cmd.Run()
+	return err == nil
+}
+
+func registerPostScanHook(hook postScanHook) {
+	postScanHooks = append(postScanHooks, hook)
+}
+
+func runPostScanHooks(host string, results []PortResult) {
+	for _, hook := range postScanHooks {
+		hook(host, results)
+	}
+}
+
+func writeTextResults(w io.Writer, host string, results []PortResult) {
+	fmt.Fprintf(w, "# %s (run %s)\n", host, runID)
+	for _, r := range results {
+		fmt.Fprintf(w, "%d\t%s\t%s\n", r.Port, r.State, r.Service)
+	}
+}
+
+func fileWriterHook(path string) postScanHook {
+	return func(host string, results []PortResult) {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Erro ao gravar resultados:", err)
+			return
+		}
+		defer file.Close()
+
+		writeTextResults(file, host, results)
+	}
+}
+
+func outputDirHook(dir, format string) postScanHook {
+	return func(host string, results []PortResult) {
+		name := strings.ReplaceAll(host, ":", "_") + "." + format
+		file, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Erro ao gravar resultados:", err)
+			return
+		}
+		defer file.Close()
+
+		if format == "json" {
+			encoder := json.NewEncoder(file)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(HostResults{RunID: runID, Host: host, Results: jsonBanners(results)})
+		} else {
+			writeTextResults(file, host, results)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Erro ao gravar resultados:", err)
+		}
+	}
+}
+
+// resultsCallback envia cada porta aberta a uma URL assim que encontrada.
+// As portas que chegam dentro de callbackBatchWindow vão juntas em um só
+// POST, e os POSTs são feitos um de cada vez, para não sobrecarregar o
+// destino numa rajada de descobertas. Falhas só geram aviso.
+type resultsCallback struct {
+	url     string
+	client  *http.Client
+	records chan StreamRecord
+	done    chan struct{}
+	dropped int64
+}
+
+func newResultsCallback(url string, timeout time.Duration) *resultsCallback {
+	c := &resultsCallback{
+		url:     url,
+		client:  &http.Client{Timeout: timeout},
+		records: make(chan StreamRecord, callbackQueueSize),
+		done:    make(chan struct{}),
+	}
+	go c.run()
+	return c
+}
+
+// Send enfileira a porta sem bloquear o scan; com a fila cheia, ela é
+// descartada e contada.
+func (c *resultsCallback) Send(ip string, result PortResult) {
+	record := StreamRecord{RunID: runID, Host: ip, Timestamp: time.Now(), PortResult: jsonBanners([]PortResult{result})[0]}
+	select {
+	case c.records <- record:
+	default:
+		atomic.AddInt64(&c.dropped, 1)
+	}
+}
+
+func (c *resultsCallback) run() {
+	defer close(c.done)
+	for first := range c.records {
+		batch := []StreamRecord{first}
+		timer := time.NewTimer(callbackBatchWindow)
+	collect:
+		for len(batch) < callbackMaxBatch {
+			select {
+			case record, ok := <-c.records:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, record)
+			case <-timer.C:
+				break collect
+			}
+		}
+		timer.Stop()
+		c.post(batch)
+	}
+}
+
+func (c *resultsCallback) post(batch []StreamRecord) {
+	payload, err := json.Marshal(batch)
+	if err != nil {
+		warnLine("Aviso: falha ao preparar -results-callback: %v", err)
+		return
+	}
+	resp, err := c.client.Post(c.url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		warnLine("Aviso: falha ao enviar %d porta(s) ao -results-callback: %v", len(batch), err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		warnLine("Aviso: -results-callback respondeu %s para %d porta(s)", resp.Status, len(batch))
+	}
+}
+
+// Close envia o que ainda estiver na fila e espera o último POST.
+func (c *resultsCallback) Close() {
+	close(c.records)
+	<-c.done
+	if dropped := atomic.LoadInt64(&c.dropped); dropped > 0 {
+		warnf("Aviso: %d porta(s) não enviada(s) ao -results-callback (fila cheia)\n", dropped)
+	}
+}
+
+func webhookHook(url string, timeout time.Duration) postScanHook {
+	client := &http.Client{Timeout: timeout}
+	return func(host string, results []PortResult) {
+		payload, err := json.Marshal(HostResults{RunID: runID, Host: host, Results: jsonBanners(results)})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Erro ao preparar webhook:", err)
+			return
+		}
+
+		resp, err := client.Post(url, "application/json", bytes.NewReader(payload))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Erro ao enviar webhook:", err)
+			return
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode >= 300 {
+			fmt.Fprintf(os.Stderr, "Webhook respondeu com status %d\n", resp.StatusCode)
+		}
+	}
+}
+
+func newRunID() string {
+	return fmt.Sprintf("%s-%08x", time.Now().UTC().Format("20060102T150405"), rand.Uint32())
+}
+
+func logf(format string, a ...interface{}) {
+	if !quiet {
+		fmt.Printf(format, a...)
+	}
+}
+
+// warnf é o logf de erros e avisos: com saída estruturada (quiet) eles vão
+// para stderr, sem sumir e sem quebrar o JSON ou a contagem no stdout.
+func warnf(format string, a ...interface{}) {
+	if quiet {
+		fmt.Fprintf(os.Stderr, format, a...)
+		return
+	}
+	fmt.Printf(format, a...)
+}
+
+func freeLocalPort() (int, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	return port, nil
+}
+
+func runSelfTest(opts ScanOptions) bool {
+	fmt.Println("Argos self-test")
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		fmt.Println("FALHA: não foi possível abrir listener local:", err)
+		return false
+	}
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	openPort := ln.Addr().(*net.TCPAddr).Port
+	closedPort := openPort + 1
+	if probe, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(closedPort))); err == nil {
+		probe.Close()
+	} else if closedPort, err = freeLocalPort(); err != nil {
+		fmt.Println("FALHA: não foi possível encontrar porta livre:", err)
+		return false
+	}
+
+	passed := true
+	checks := []struct {
+		port  int
+		state string
+	}{
+		{openPort, "open"},
+		{closedPort, "closed"},
+	}
+
+	for _, check := range checks {
+		result := scanPort(context.Background(), "127.0.0.1", check.port, opts)
+		if result.State == check.state {
+			fmt.Printf("OK:    porta %d detectada como %s (%s)\n", check.port, result.State, result.Reason)
+		} else {
+			fmt.Printf("FALHA: porta %d detectada como %s, esperado %s (%s)\n", check.port, result.State, check.state, result.Reason)
+			passed = false
+		}
+	}
+
+	if passed {
+		fmt.Println("Self-test concluído com sucesso.")
+	} else {
+		fmt.Println("Self-test falhou.")
+	}
+	return passed
+}
+
+// progressLine descreve o andamento do host atual; em varreduras com mais de
+// um host, mostra antes quantos hosts já foram concluídos e o total geral.
+func progressLine(ip string, scanned, total int, opts ScanOptions) string {
+	hostPct := float64(scanned) / float64(total) * 100
+	if opts.HostCount <= 1 {
+		return fmt.Sprintf("\rEscaneando... %.1f%% concluído", hostPct)
+	}
+	overall := (float64(opts.HostIndex-1) + float64(scanned)/float64(total)) / float64(opts.HostCount) * 100
+	return fmt.Sprintf("\rHosts: %d/%d concluídos (%.1f%%) | host %d (%s): %.1f%% das portas",
+		opts.HostIndex-1, opts.HostCount, overall, opts.HostIndex, ip, hostPct)
+}
+
+func logLine(format string, a ...interface{}) {
+	line := fmt.Sprintf(format, a...)
+	if progress {
+		line = "\r" + line + "          "
+	}
+	logf("%s\n", line)
+}
+
+func warnLine(format string, a ...interface{}) {
+	line := fmt.Sprintf(format, a...)
+	if progress {
+		line = "\r" + line + "          "
+	}
+	warnf("%s\n", line)
+}
+
+// isTerminal pergunta ao sistema se f é um terminal; olhar só o modo de
+// dispositivo de caractere confundiria /dev/null (a entrada do cron) com um.
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+func main() {
+	for _, arg := range os.Args[1:] {
+		if arg == "-help" || arg == "--help" || arg == "-h" {
+			showCustomHelp()
+			return
+		}
+		if arg == "-version" || arg == "--version" || arg == "-V" {
+			showVersion()
+			return
+		}
+		if arg == "-print-schema" || arg == "--print-schema" {
+			printSchema()
+			return
+		}
+	}
+
+	var (
+		portRange string
+		host      string
+		threads   int
+		verbose   bool
+	)
+	timeout := millisDuration(defaultTimeout)
+
+	targetList := flag.String("targets", "", "Pares host:porta verificados exatamente (ex: host1:22,host2:443)")
+	flag.StringVar(&host, "host", "", "Host(s) ou redes CIDR para escanear, separados por vírgula (obrigatório)")
+	excludeHosts := flag.String("exclude-hosts", "", "Endereços ou redes CIDR a não escanear (ex: 10.0.0.5,10.0.1.0/24)")
+	flag.StringVar(&portRange, "p", "1-1024", "Range de portas para escanear (ex: 22,80,100-200)")
+	flag.IntVar(&threads, "t", defaultThreads, "Número de threads concorrentes")
+	flag.Var(&timeout, "timeout", "Timeout de conexão (ex: 500ms, 2s; número puro = milissegundos)")
+	flag.BoolVar(&verbose, "v", false, "Modo verbose - exibe mais informações")
+	groupVerbose := flag.Bool("group-verbose", false, "Modo verbose agrupando a saída de cada host em um bloco ao final do host")
+	useIPv4 := flag.Bool("4", true, "Preferir IPv4, usando IPv6 se o host não tiver IPv4")
+	only4 := flag.Bool("4only", false, "Exigir IPv4: erro se o host não tiver endereço IPv4")
+	only6 := flag.Bool("6only", false, "Exigir IPv6: erro se o host não tiver endereço IPv6")
+	pn := flag.Bool("Pn", false, "Pular host discovery (assume host online)")
+	alivePortList := flag.String("alive-ports", "80,443", "Portas TCP usadas para verificar se o host está online")
+	randomize := flag.Bool("randomize", false, "Escanear as portas em ordem aleatória")
+	seed := flag.Int64("seed", 0, "Semente do -randomize para reproduzir a ordem (0 = baseada no horário)")
+	limitHosts := flag.Int("limit-hosts", 0, "Escanear só N dos hosts expandidos (sorteados com -randomize)")
+	topN := flag.Int("top-ports", 0, "Escanear as N portas mais comuns")
+	scanAll := flag.Bool("scan-all", false, "Escanear todas as portas, 1-65535 (o mesmo que -p-)")
+	assumeYes := flag.Bool("y", false, "Não pedir confirmação antes de scans grandes")
+	estTime := flag.Bool("est-time", false, "Exibir a duração estimada do scan e sair sem escanear")
+	flag.BoolVar(assumeYes, "yes", false, "Não pedir confirmação antes de scans grandes")
+	smartOrder := flag.Bool("smart-order", false, "Escanear primeiro as portas mais comuns, sem mudar o conjunto escaneado")
+	servicesFile := flag.String("services-file", "", "Arquivo nmap-services usado pelo -top-ports")
+	autoThreads := flag.Bool("auto-threads", false, "Ajustar as threads conforme a taxa de timeouts, usando -t como teto")
+	rate := flag.Int("rate", 0, "Máximo de novas conexões por segundo (0 = sem limite)")
+	minRate := flag.Int("min-rate", 0, "Mínimo de novas conexões por segundo (0 = desativado)")
+	maxOpen := flag.Int("max-open", 0, "Parar o host ao encontrar N portas abertas, marcando-o como provável tarpit (0 = sem limite)")
+	skipClosedFast := flag.Bool("skip-closed-fast", false, "Ampliar as threads quando o host recusa conexões de imediato (RST)")
+	failFast := flag.Bool("fail-fast", false, "Interromper o scan na primeira porta aberta encontrada")
+	retries := flag.Int("retries", 0, "Novas tentativas por porta após timeout")
+	retryOnReset := flag.Int("retry-on-reset", 0, "Novas tentativas por porta após conexão recusada (RST)")
+	retryDelaySpec := flag.String("retry-delay", "auto", "Pausa antes de cada nova tentativa (ex: 200ms; auto = só fora da rede local)")
+	retryBackoff := flag.Float64("retry-backoff", 2, "Multiplicador da pausa a cada nova tentativa (1 = pausa fixa)")
+	confidenceSpec := flag.String("min-open-confidence", "", "Confirmar portas abertas por votação K/N (ex: 2/3)")
+	flag.StringVar(confidenceSpec, "confidence", "", "Confirmar portas abertas por votação K/N (ex: 2/3)")
+	budget := flag.Int("retry-budget", 0, "Limite total de novas tentativas no scan inteiro (0 = sem limite)")
+	probeOrderSpec := flag.String("probe-order", "", "Ordem dos probes de identificação de serviço (read, http, crlf)")
+	probeTimeout := flag.Duration("probe-timeout", bannerReadTimeout, "Tempo de espera pela resposta de banners e probes (ex: 200ms, 2s)")
+	hostTimeout := flag.Duration("host-timeout", 0, "Tempo máximo gasto em cada host (ex: 30s, 5m)")
+	watch := flag.Int("watch", 0, "Monitorar continuamente uma única porta")
+	interval := flag.Int("interval", 5, "Intervalo em segundos entre verificações do -watch")
+	noProgress := flag.Bool("no-progress", false, "Desativar a barra de progresso")
+	statsEvery := flag.Duration("stats-every", 0, "Intervalo entre linhas de progresso (ex: 10s)")
+	sctp := flag.Bool("sY", false, "Scan SCTP (INIT) em vez de TCP")
+	gracefulClose := flag.Bool("graceful-close", false, "Encerrar conexões abertas com FIN em vez de RST")
+	trace := flag.Bool("traceroute", false, "Exibir a rota até o host antes do scan")
+	outputFile := flag.String("o", "", "Gravar resultados em arquivo")
+	outputDir := flag.String("output-dir", "", "Diretório para gravar um arquivo de resultados por host")
+	outputFormat := flag.String("output-format", "txt", "Formato dos arquivos do -output-dir: txt ou json")
+	resolvePTR := flag.Bool("resolve-ptr", false, "Consultar o nome reverso (PTR) de cada endereço antes do scan")
+	ptrTimeout := flag.Duration("ptr-timeout", 2*time.Second, "Tempo máximo de cada consulta PTR")
+	ptrThreads := flag.Int("ptr-threads", 20, "Consultas PTR simultâneas")
+	useSyslog := flag.Bool("syslog", false, "Enviar cada porta aberta ao syslog local")
+	syslogAddr := flag.String("syslog-addr", "", "Servidor syslog remoto ([udp|tcp://]host:porta); implica -syslog")
+	webhook := flag.String("webhook", "", "URL para enviar os resultados de cada host via POST (JSON)")
+	baselinePath := flag.String("baseline", "", "Relatório -json anterior: destaca portas novas durante o scan e lista NOVAS e AUSENTES ao final")
+	rescanPath := flag.String("rescan-filtered", "", "Relatório -json anterior: reescaneia só as portas filtradas dele e atualiza o relatório")
+	resultsCallbackURL := flag.String("results-callback", "", "URL que recebe via POST cada porta aberta assim que encontrada (JSON)")
+	tarpitCheck := flag.Bool("detect-tarpit", false, "Identificar hosts que aceitam quase todas as portas com resposta idêntica (tarpit/honeypot)")
+	detectFlapping := flag.Bool("detect-flapping", false, "Escanear duas vezes e exibir portas que mudaram de estado")
+	flapDelay := flag.Duration("flap-delay", 5*time.Second, "Intervalo entre as passagens do -detect-flapping")
+	rollup := flag.Bool("rollup", false, "Resumir, ao final, quantos hosts expõem cada serviço")
+	matrix := flag.Bool("matrix", false, "Exibir ao final uma grade host × porta com o estado de cada uma, em vez da tabela por host")
+	onlyServices := flag.String("only-services", "", "Exibir apenas os serviços listados (ex: ssh,http)")
+	sortBy := flag.String("sort", "port", "Ordenação dos resultados: port, latency, service ou state")
+	assertOpen := flag.String("assert-open", "", "Portas que precisam estar abertas; falha sai com código 2 (CRITICAL)")
+	assertClosed := flag.String("assert-closed", "", "Portas que precisam estar fechadas; falha sai com código 2 (CRITICAL)")
+	expect := flag.String("expect", "", "Portas que devem estar abertas (ex: 22,80,443)")
+	bannerEncodingFlag := flag.String("banner-encoding", "safe", "Exibição dos banners: safe, utf8, latin1 ou hex")
+	fingerprintUnknown := flag.Bool("fingerprint-unknown", false, "Exibir dump hexadecimal dos banners de serviços desconhecidos")
+	reason := flag.Bool("reason", false, "Exibir o motivo do estado de cada porta")
+	runIDFlag := flag.String("run-id", "", "ID da execução incluído em todas as saídas (default: gerado)")
+	jsonOut := flag.Bool("json", false, "Emitir o resultado completo em JSON ao final do scan")
+	jsonPretty := flag.Bool("json-pretty", false, "JSON indentado para leitura (implica -json, exceto com -jsonl)")
+	jsonl := flag.Bool("jsonl", false, "Emitir cada porta aberta como uma linha JSON assim que encontrada")
+	greppable := flag.Bool("greppable", false, "Saída em linhas grep-friendly, uma por porta aberta")
+	greppableClosed := flag.Bool("greppable-closed", false, "Saída grep-friendly incluindo portas fechadas e filtradas")
+	countOnly := flag.Bool("count-only", false, "Exibir apenas o número de portas abertas")
+	portsOnly := flag.Bool("ports-only", false, "Exibir apenas a lista de portas abertas por host")
+	httpPathsFile := flag.String("http-paths", "", "Wordlist de caminhos testados (HEAD) em portas HTTP abertas")
+	sshJump := flag.String("ssh-jump", "", "Escanear através de um bastion SSH (usuário@host[:porta])")
+	sshKey := flag.String("ssh-key", defaultSSHPath("id_ed25519", "id_ecdsa", "id_rsa"), "Chave privada para o -ssh-jump")
+	sshKnownHosts := flag.String("ssh-known-hosts", defaultSSHPath("known_hosts"), "Arquivo known_hosts usado para validar o bastion")
+	httpProxy := flag.String("http-proxy", "", "Escanear através de um proxy HTTP CONNECT (host:porta)")
+	proxyAuth := flag.String("proxy-auth", "", "Credenciais do proxy HTTP no formato usuário:senha")
+	showHost := flag.Bool("show-host", false, "Incluir coluna HOST na tabela (automático com mais de um host)")
+	timingDebug := flag.Bool("timing-debug", false, "Exibir, por porta aberta, o tempo gasto em dial, leitura de banner e probes")
+	tcpDetailsFlag := flag.Bool("tcp-details", false, "Exibir a janela TCP e o MSS de cada porta aberta (Linux)")
+	verifyTLS := flag.Bool("verify-tls-hostname", false, "Validar o certificado de cada porta TLS aberta contra o nome escaneado")
+	twoPhase := flag.Bool("two-phase", false, "Descobrir as portas abertas primeiro e coletar banners depois, só nelas")
+	noSynBackoff := flag.Bool("no-syn-backoff", false, "Não reduzir as threads quando os timeouts disparam no meio do scan")
+	osWeighted := flag.Bool("os-weighted-ports", false, "Priorizar as portas típicas do SO assim que ele for inferido (com -top-ports e -passive-os-guess)")
+	osGuess := flag.Bool("passive-os-guess", false, "Inferir o SO do host a partir dos banners das portas abertas")
+	bannerOnly := flag.Bool("banner-only", false, "Apenas coletar e exibir os banners das portas informadas")
+	format := flag.String("format", "", "Template Go para formatar cada porta encontrada")
+	flag.BoolVar(&noDNS, "n", false, "Não resolver nomes: -host aceita apenas IPs e redes CIDR")
+	flag.BoolVar(&noDNS, "no-dns", false, "Não resolver nomes: -host aceita apenas IPs e redes CIDR")
+	dnsServer := flag.String("dns-server", "", "Servidor DNS usado nas resoluções (ex: 8.8.8.8:53)")
+	resolveAll := flag.Bool("resolve-all", false, "Exibir todos os registros A/AAAA do host")
+	allAddrs := flag.Bool("all-addrs", false, "Escanear todos os endereços resolvidos do host")
+	skipOffline := flag.Bool("skip-offline", false, "Não escanear hosts que falharem na verificação de host online")
+	dual := flag.Bool("dual", false, "Escanear endereços IPv4 e IPv6 do host")
+	listenCheck := flag.Bool("listen-check", false, "Verificar quais portas estão livres para bind nesta máquina (apenas local)")
+	selfTest := flag.Bool("selftest", false, "Verificar o funcionamento do scanner contra um listener local")
+	flag.String("config", "", "Arquivo de configuração com valores padrão")
+
+	if configPath := findConfigArg(os.Args[1:]); configPath != "" {
+		if err := applyConfigFile(configPath); err != nil {
+			fmt.Println("Erro:", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := applyEnvDefaults(); err != nil {
+		fmt.Println("Erro:", err)
+		os.Exit(1)
+	}
+
+	flag.Usage = showCustomHelp
+	flag.CommandLine.Parse(expandPortShortcut(os.Args[1:]))
+
+	if *greppableClosed {
+		*greppable = true
+	}
+	if *jsonPretty && !*jsonl {
+		*jsonOut = true
+	}
+	quiet = *portsOnly || *countOnly || *greppable || *jsonl || *jsonOut || *assertOpen != "" || *assertClosed != ""
+	progress = !quiet && !*noProgress && isTerminal(os.Stdout)
+	runID = *runIDFlag
+	if runID == "" {
+		runID = newRunID()
+	}
+
+	if *selfTest {
+		opts := ScanOptions{Timeout: time.Duration(timeout)}
+		if !runSelfTest(opts) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if threads <= 0 {
+		fmt.Println("Erro: -t deve ser maior que zero")
+		os.Exit(1)
+	}
+
+	if *listenCheck {
+		ports, err := parsePortRange(portRange)
+		if err != nil {
+			fmt.Println("Erro no range de portas:", err)
+			os.Exit(1)
+		}
+		if len(ports) == 0 {
+			for i := 1; i <= 1024; i++ {
+				ports = append(ports, i)
+			}
+		}
+		runListenCheck(ports, threads)
+		return
+	}
+
+	switch *bannerEncodingFlag {
+	case "safe", "utf8", "latin1", "hex":
+		bannerEncoding = *bannerEncodingFlag
+	default:
+		fmt.Println("Erro: -banner-encoding deve ser safe, utf8, latin1 ou hex")
+		os.Exit(1)
+	}
+
+	switch *sortBy {
+	case "port", "latency", "service", "state":
+	default:
+		fmt.Println("Erro: -sort deve ser port, latency, service ou state")
+		os.Exit(1)
+	}
+
+	var resultTemplate *template.Template
+	if *format != "" {
+		var err error
+		resultTemplate, err = template.New("format").Parse(*format)
+		if err != nil {
+			fmt.Println("Erro no template de -format:", err)
+			os.Exit(1)
+		}
+	}
+
+	if *rescanPath != "" && (host != "" || *targetList != "") {
+		fmt.Println("Erro: -rescan-filtered usa os hosts do relatório e não aceita -host nem -targets")
+		os.Exit(1)
+	}
+
+	var pairs []TargetPair
+	if *targetList != "" {
+		if host != "" {
+			fmt.Println("Erro: -targets não pode ser usado com -host")
+			os.Exit(1)
+		}
+		// A saída do -targets é só a tabela de pares; os formatos e hooks do
+		// scan normal seriam ignorados em silêncio.
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{
+			{"-json", *jsonOut},
+			{"-jsonl", *jsonl},
+			{"-greppable", *greppable},
+			{"-count-only", *countOnly},
+			{"-ports-only", *portsOnly},
+			{"-sY", *sctp},
+			{"-o", *outputFile != ""},
+			{"-output-dir", *outputDir != ""},
+			{"-webhook", *webhook != ""},
+			{"-results-callback", *resultsCallbackURL != ""},
+			{"-baseline", *baselinePath != ""},
+			{"-syslog", *useSyslog || *syslogAddr != ""},
+			{"-resolve-ptr", *resolvePTR},
+			{"-verify-tls-hostname", *verifyTLS},
+		} {
+			if f.set {
+				fmt.Printf("Erro: -targets não pode ser usado com %s\n", f.name)
+				os.Exit(1)
+			}
+		}
+		var err error
+		pairs, err = parseTargetPairs(*targetList)
+		if err != nil {
+			fmt.Println("Erro em -targets:", err)
+			os.Exit(1)
+		}
+		if noDNS {
+			for _, pair := range pairs {
+				if literal, _ := splitZone(pair.Host); net.ParseIP(literal) == nil {
+					fmt.Printf("Erro: %s não é um IP literal; -no-dns aceita apenas IPs\n", pair.Host)
+					os.Exit(1)
+				}
+			}
+		}
+	}
+
+	if host == "" && *targetList == "" && *rescanPath == "" && !isTerminal(os.Stdin) {
+		fmt.Fprintln(os.Stderr, "Erro: -host é obrigatório quando a entrada não é um terminal")
+		fmt.Fprintln(os.Stderr, "Use -h para ver as opções disponíveis")
+		os.Exit(1)
+	}
+
+	if host == "" && *targetList == "" && *rescanPath == "" {
+		in := bufio.NewReader(os.Stdin)
+		for host == "" {
+			fmt.Print("Digite o host para escanear: ")
+			line, err := readHost(in)
+			switch {
+			case err == io.EOF:
+				fmt.Println()
+				fmt.Fprintln(os.Stderr, "Erro: entrada encerrada sem um host; informe-o com -host")
+				os.Exit(1)
+			case err != nil:
+				fmt.Println("Erro:", err)
+			default:
+				host = line
+			}
+		}
+	}
+
+	if *dnsServer != "" {
+		resolver = newResolver(*dnsServer)
+	}
+	hosts, err := expandTargets(host)
+	if err != nil {
+		fmt.Println("Erro:", err)
+		os.Exit(1)
+	}
+	if noDNS {
+		for _, h := range hosts {
+			if literal, _ := splitZone(h); net.ParseIP(literal) == nil {
+				fmt.Printf("Erro: %s não é um IP literal; -no-dns aceita apenas IPs e redes CIDR\n", h)
+				os.Exit(1)
+			}
+		}
+	}
+	excluded, err := parseExclusions(*excludeHosts)
+	if err != nil {
+		fmt.Println("Erro em -exclude-hosts:", err)
+		os.Exit(1)
+	}
+	var family string
+	switch {
+	case *only4 && *only6:
+		fmt.Println("Erro: -4only e -6only não podem ser usados juntos")
+		os.Exit(1)
+	case (*only4 || *only6) && *dual:
+		fmt.Println("Erro: -dual não pode ser usado com -4only ou -6only")
+		os.Exit(1)
+	case *only4:
+		family = "IPv4"
+	case *only6:
+		family = "IPv6"
+	}
+	targets := resolveTargets(hosts, ResolveOptions{
+		Dual:       *dual,
+		PreferIPv4: *useIPv4,
+		Family:     family,
+		ShowAll:    *resolveAll,
+		AllAddrs:   *allAddrs,
+	})
+	if len(excluded) > 0 {
+		var removed int
+		targets, removed = excludeTargets(targets, excluded)
+		logf("%d endereço(s) removido(s) por -exclude-hosts, %d host(s) a escanear.\n", removed, len(targets))
+	}
+	if len(targets) == 0 && *targetList == "" && *rescanPath == "" {
+		os.Exit(1)
+	}
+	if *limitHosts < 0 {
+		fmt.Println("Erro: -limit-hosts não pode ser negativo")
+		os.Exit(1)
+	}
+	if *limitHosts > 0 && *limitHosts < len(targets) {
+		total := len(targets)
+		var rng *rand.Rand
+		if *randomize {
+			if *seed == 0 {
+				*seed = time.Now().UnixNano()
+			}
+			rng = rand.New(rand.NewSource(*seed))
+		}
+		targets = sampleTargets(targets, *limitHosts, rng)
+		if rng != nil {
+			logf("Amostra de %d de %d host(s), sorteada com -seed %d.\n", len(targets), total, *seed)
+		} else {
+			logf("Amostra de %d de %d host(s): os primeiros da lista.\n", len(targets), total)
+		}
+	}
+	if *resolvePTR {
+		if noDNS {
+			fmt.Println("Erro: -resolve-ptr não pode ser usado com -no-dns")
+			os.Exit(1)
+		}
+		if *ptrThreads <= 0 {
+			fmt.Println("Erro: -ptr-threads deve ser maior que zero")
+			os.Exit(1)
+		}
+		if *ptrTimeout <= 0 {
+			fmt.Println("Erro: -ptr-timeout deve ser maior que zero")
+			os.Exit(1)
+		}
+		ptrStart := time.Now()
+		found := resolvePTRs(targets, *ptrThreads, *ptrTimeout)
+		logf("PTR: %d de %d endereço(s) com nome reverso (%.2fs)\n", found, len(targets), time.Since(ptrStart).Seconds())
+	}
+	resolved := 0
+	for _, t := range targets {
+		resolved += len(t.Names)
+	}
+	if resolved > len(targets) && !*dual && !*allAddrs {
+		logf("%d hosts informados resolvem para %d endereços distintos.\n", resolved, len(targets))
+	}
+
+	timeoutDuration := time.Duration(timeout)
+
+	if *retries < 0 {
+		fmt.Println("Erro: -retries não pode ser negativo")
+		os.Exit(1)
+	}
+	retryDelay, retryAuto, err := parseRetryDelay(*retryDelaySpec)
+	if err != nil {
+		fmt.Println("Erro em -retry-delay:", err)
+		os.Exit(1)
+	}
+	if *retryBackoff < 1 || *retryBackoff > 10 {
+		fmt.Println("Erro: -retry-backoff deve estar entre 1 e 10")
+		os.Exit(1)
+	}
+	if *maxOpen < 0 {
+		fmt.Println("Erro: -max-open não pode ser negativo")
+		os.Exit(1)
+	}
+	var probeOrder []string
+	if *probeOrderSpec != "" {
+		if probeOrder, err = parseProbeOrder(*probeOrderSpec); err != nil {
+			fmt.Println("Erro em -probe-order:", err)
+			os.Exit(1)
+		}
+	}
+	if *retryOnReset < 0 {
+		fmt.Println("Erro: -retry-on-reset não pode ser negativo")
+		os.Exit(1)
+	}
+	confirmNeed, confirmOf := 1, 1
+	if *confidenceSpec != "" {
+		var err error
+		if confirmNeed, confirmOf, err = parseConfidence(*confidenceSpec); err != nil {
+			fmt.Println("Erro em -min-open-confidence:", err)
+			os.Exit(1)
+		}
+	}
+	if *rate < 0 || *rate > maxRate {
+		fmt.Printf("Erro: -rate deve estar entre 0 e %d\n", maxRate)
+		os.Exit(1)
+	}
+	if *minRate < 0 || *minRate > maxRate {
+		fmt.Printf("Erro: -min-rate deve estar entre 0 e %d\n", maxRate)
+		os.Exit(1)
+	}
+	if *rate > 0 && *minRate > *rate {
+		fmt.Println("Erro: -min-rate não pode ser maior que -rate")
+		os.Exit(1)
+	}
+	if *autoThreads && *minRate > 0 {
+		fmt.Println("Erro: -auto-threads e -min-rate não podem ser usados juntos")
+		os.Exit(1)
+	}
+	if *osWeighted && (*topN == 0 || !*osGuess) {
+		fmt.Println("Erro: -os-weighted-ports exige -top-ports e -passive-os-guess")
+		os.Exit(1)
+	}
+
+	protocol := "tcp"
+	if *sctp {
+		if err := checkSCTPSupport(); err != nil {
+			fmt.Println("Erro:", err)
+			os.Exit(1)
+		}
+		protocol = "sctp"
+	}
+
+	opts := ScanOptions{
+		Protocol:      protocol,
+		Threads:       threads,
+		Timeout:       timeoutDuration,
+		Verbose:       verbose || *groupVerbose,
+		GroupVerbose:  *groupVerbose,
+		StatsEvery:    *statsEvery,
+		GracefulClose: *gracefulClose,
+		Rate:          *rate,
+		MinRate:       *minRate,
+		AutoThreads:   *autoThreads,
+		FailFast:      *failFast,
+		MaxOpen:       *maxOpen,
+		FastClosed:    *skipClosedFast,
+		TwoPhase:      *twoPhase,
+		TimingDebug:   *timingDebug,
+		TCPDetails:    *tcpDetailsFlag,
+		GrabBanners:   *osGuess,
+		OSWeighted:    *osWeighted,
+		NoSynBackoff:  *noSynBackoff,
+		HostTimeout:   *hostTimeout,
+		Retries:       *retries,
+		ResetRetries:  *retryOnReset,
+		RetryDelay:    retryDelay,
+		RetryAuto:     retryAuto,
+		RetryBackoff:  *retryBackoff,
+		ConfirmNeed:   confirmNeed,
+		ConfirmOf:     confirmOf,
+		ProbeTimeout:  *probeTimeout,
+		ProbeOrder:    probeOrder,
+		RetryBudget:   newRetryBudget(*budget),
+		KeepAll:       *detectFlapping || *greppableClosed || *tarpitCheck || *reason || *matrix,
+	}
+
+	if (*httpProxy != "" || *sshJump != "") && *trace {
+		fmt.Println("Erro: -traceroute sai direto deste host e não pode ser usado com -http-proxy ou -ssh-jump")
+		os.Exit(1)
+	}
+	if *httpProxy != "" {
+		if *proxyAuth != "" && !strings.Contains(*proxyAuth, ":") {
+			fmt.Println("Erro: -proxy-auth deve estar no formato usuário:senha")
+			os.Exit(1)
+		}
+		opts.Dial = httpProxyDialer(*httpProxy, *proxyAuth, timeoutDuration)
+		// Um CONNECT ao próprio proxy valida alcance e credenciais sem tocar
+		// nos alvos; sem isso, um 407 marcaria todas as portas como fechadas.
+		conn, err := opts.Dial(context.Background(), "tcp", *httpProxy)
+		if errors.Is(err, errProxyAuth) || (err != nil && !errors.Is(err, syscall.ECONNREFUSED)) {
+			fmt.Println("Erro ao usar -http-proxy:", err)
+			os.Exit(1)
+		}
+		if conn != nil {
+			conn.Close()
+		}
+		if !*pn {
+			*pn = true
+		}
+		logf("Scan via proxy HTTP CONNECT %s: os resultados refletem o que o proxy alcança, não este host (verificação de host desativada).\n", *httpProxy)
+	}
+	if *sshJump != "" {
+		if *httpProxy != "" {
+			fmt.Println("Erro: -ssh-jump e -http-proxy não podem ser usados juntos")
+			os.Exit(1)
+		}
+		dial, client, err := sshJumpDialer(*sshJump, *sshKey, *sshKnownHosts, timeoutDuration)
+		if err != nil {
+			fmt.Println("Erro ao conectar ao -ssh-jump:", err)
+			os.Exit(1)
+		}
+		defer client.Close()
+		opts.Dial = dial
+		if !*pn {
+			*pn = true
+		}
+		logf("Scan via bastion SSH %s: os resultados refletem o que o bastion alcança, não este host (verificação de host desativada).\n", *sshJump)
+	}
+
+	serviceFilter := parseServiceFilter(*onlyServices)
+
+	if *jsonl {
+		encoder := json.NewEncoder(os.Stdout)
+		if *jsonPretty {
+			encoder.SetIndent("", "  ")
+		}
+		opts.OnResult = func(ip string, result PortResult) {
+			if serviceFilter != nil && !serviceFilter[strings.ToLower(result.Service)] {
+				return
+			}
+			encoder.Encode(StreamRecord{RunID: runID, Host: ip, Timestamp: time.Now(), PortResult: jsonBanners([]PortResult{result})[0]})
+		}
+	}
+
+	if *targetList != "" {
+		runTargetPairs(pairs, opts)
+		return
+	}
+
+	if *rescanPath != "" {
+		report, err := loadReport(*rescanPath)
+		if err != nil {
+			fmt.Println("Erro em -rescan-filtered:", err)
+			os.Exit(1)
+		}
+		changes := rescanFiltered(context.Background(), &report, opts)
+		report.RunID = runID
+		if !*jsonOut {
+			printRescan(report, changes)
+			return
+		}
+		var data []byte
+		if *jsonPretty {
+			data, err = json.MarshalIndent(report, "", "  ")
+		} else {
+			data, err = json.Marshal(report)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Erro ao gerar JSON:", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+		return
+	}
 
-	if err == nil && conn != nil {
-		defer conn.Close()
-		result.State = "open"
+	if *watch > 0 {
+		if *interval <= 0 {
+			fmt.Println("Erro: -interval deve ser maior que zero")
+			os.Exit(1)
+		}
+		watchPort(targets[0].Label(), targets[0].IP, *watch, opts, time.Duration(*interval)*time.Second)
+		return
+	}
 
-		if service, ok := commonPorts[port]; ok {
-			result.Service = service
+	ports, err := parsePortRange(portRange)
+	if err != nil {
+		fmt.Println("Erro no range de portas:", err)
+		os.Exit(1)
+	}
+
+	if *scanAll {
+		if *topN > 0 {
+			fmt.Println("Erro: -scan-all não pode ser usado com -top-ports")
+			os.Exit(1)
+		}
+		ports, _ = parsePortRange("1-65535")
+	}
+
+	if *topN > 0 {
+		ports, err = topPorts(*topN, *servicesFile)
+		if err != nil {
+			fmt.Println("Erro:", err)
+			os.Exit(1)
+		}
+		if len(ports) < *topN {
+			warnf("Aviso: apenas %d portas disponíveis na lista de top-ports.\n", len(ports))
+		}
+	}
+
+	if len(ports) == 0 {
+		for i := 1; i <= 1024; i++ {
+			ports = append(ports, i)
+		}
+	}
+
+	var httpPaths []string
+	if *httpPathsFile != "" {
+		httpPaths, err = loadWordlist(*httpPathsFile)
+		if err != nil {
+			fmt.Println("Erro:", err)
+			os.Exit(1)
+		}
+	}
+
+	var expectedPorts []int
+	if *expect != "" {
+		expectedPorts, err = parsePortRange(*expect)
+		if err != nil {
+			fmt.Println("Erro nas portas esperadas:", err)
+			os.Exit(1)
+		}
+		ports = mergePorts(ports, expectedPorts)
+	}
+	var assertOpenPorts, assertClosedPorts []int
+	if *assertOpen != "" {
+		assertOpenPorts, err = parsePortRange(*assertOpen)
+		if err != nil {
+			fmt.Println("Erro em -assert-open:", err)
+			os.Exit(1)
+		}
+		ports = mergePorts(ports, assertOpenPorts)
+	}
+	if *assertClosed != "" {
+		assertClosedPorts, err = parsePortRange(*assertClosed)
+		if err != nil {
+			fmt.Println("Erro em -assert-closed:", err)
+			os.Exit(1)
+		}
+		ports = mergePorts(ports, assertClosedPorts)
+	}
+	asserting := assertOpenPorts != nil || assertClosedPorts != nil
+	var assertFailures []string
+	if *randomize {
+		if *seed == 0 {
+			*seed = time.Now().UnixNano()
+		}
+		rand.New(rand.NewSource(*seed)).Shuffle(len(ports), func(i, j int) {
+			ports[i], ports[j] = ports[j], ports[i]
+		})
+		if verbose {
+			logf("Ordem das portas embaralhada com -seed %d\n", *seed)
+		}
+	}
+	if *smartOrder {
+		if *randomize {
+			fmt.Println("Erro: -smart-order não pode ser usado com -randomize")
+			os.Exit(1)
+		}
+		ranked, err := topPorts(math.MaxInt, *servicesFile)
+		if err != nil {
+			fmt.Println("Erro:", err)
+			os.Exit(1)
+		}
+		orderByFrequency(ports, ranked)
+	}
+
+	alivePorts, err := parsePortRange(*alivePortList)
+	if err != nil {
+		fmt.Println("Erro nas portas de -alive-ports:", err)
+		os.Exit(1)
+	}
+
+	if *matrix {
+		if len(ports) > matrixMaxPorts {
+			fmt.Printf("Erro: -matrix comporta até %d portas por grade (recebeu %d)\n", matrixMaxPorts, len(ports))
+			os.Exit(1)
+		}
+		// A grade substitui a saída por host; os outros formatos também.
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{
+			{"-json", *jsonOut},
+			{"-jsonl", *jsonl},
+			{"-greppable", *greppable || *greppableClosed},
+			{"-count-only", *countOnly},
+			{"-ports-only", *portsOnly},
+			{"-banner-only", *bannerOnly},
+		} {
+			if f.set {
+				fmt.Printf("Erro: -matrix não pode ser usado com %s\n", f.name)
+				os.Exit(1)
+			}
+		}
+	}
+
+	estimate := estimateScanTime(len(targets), len(ports), opts).Round(time.Second)
+	estimateLine := fmt.Sprintf("Duração estimada: até %s para %d porta(s) em %d host(s) (limite superior, com todas as portas expirando)", estimate, len(ports), len(targets))
+	if *estTime {
+		fmt.Println(estimateLine)
+		return
+	}
+	// Sem terminal na entrada (cron, CI, pipes) não há quem responda: a
+	// estimativa vai para a saída de erro e o scan segue.
+	largeScan := (len(ports) == 65535 || estimate > confirmScanAbove) && !*assumeYes
+	if largeScan && isTerminal(os.Stdin) {
+		if !confirm(estimateLine + ". Continuar?") {
+			fmt.Fprintln(os.Stderr, "Scan cancelado; use -y para confirmar sem pergunta.")
+			os.Exit(1)
+		}
+	} else if largeScan {
+		fmt.Fprintln(os.Stderr, estimateLine)
+	} else {
+		logf("%s\n", estimateLine)
+	}
+
+	discrepancies := false
+	foundOpen := false
+
+	if *outputFile != "" {
+		registerPostScanHook(fileWriterHook(*outputFile))
+	}
+	if *webhook != "" {
+		registerPostScanHook(webhookHook(*webhook, 10*time.Second))
+	}
+	var baseline map[string]bool
+	if *baselinePath != "" {
+		baseline, err = loadBaseline(*baselinePath)
+		if err != nil {
+			fmt.Println("Erro em -baseline:", err)
+			os.Exit(1)
+		}
+		onResult := opts.OnResult
+		opts.OnResult = func(ip string, result PortResult) {
+			if onResult != nil {
+				onResult(ip, result)
+			}
+			if !baseline[net.JoinHostPort(ip, strconv.Itoa(result.Port))] {
+				logLine("NOVA: %s porta %d aberta (%s), fora do baseline", ip, result.Port, result.Service)
+			}
+		}
+	}
+	var callback *resultsCallback
+	if *resultsCallbackURL != "" {
+		callback = newResultsCallback(*resultsCallbackURL, 10*time.Second)
+		onResult := opts.OnResult
+		opts.OnResult = func(ip string, result PortResult) {
+			if onResult != nil {
+				onResult(ip, result)
+			}
+			callback.Send(ip, result)
+		}
+	}
+	if *useSyslog || *syslogAddr != "" {
+		hook, closeSyslog, err := newSyslogHook(*syslogAddr, opts.Protocol)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Aviso: syslog indisponível, resultados não serão enviados:", err)
+		} else {
+			defer closeSyslog()
+			registerPostScanHook(hook)
+		}
+	}
+	if *outputDir != "" {
+		if *outputFormat != "txt" && *outputFormat != "json" {
+			fmt.Println("Erro: -output-format deve ser txt ou json")
+			os.Exit(1)
+		}
+		if err := os.MkdirAll(*outputDir, 0755); err != nil {
+			fmt.Println("Erro ao criar diretório de saída:", err)
+			os.Exit(1)
+		}
+		registerPostScanHook(outputDirHook(*outputDir, *outputFormat))
+	}
+
+	output := OutputOptions{
+		Template:           resultTemplate,
+		ShowReason:         *reason,
+		FingerprintUnknown: *fingerprintUnknown,
+		ShowHost:           *showHost || len(targets) > 1,
+	}
+	if output.ShowHost {
+		sortTargets(targets)
+	}
+
+	proxyLabel := *httpProxy
+	if *sshJump != "" {
+		proxyLabel = "ssh://" + *sshJump
+	}
+	report := JSONReport{RunID: runID, Proxy: proxyLabel, Hosts: []JSONHost{}, Stats: newScanStats()}
+	var hostScans []HostScan
+	offlineHosts := 0
+	startTime := time.Now()
+	logf("ID da execução: %s\n", runID)
+
+	for i, target := range targets {
+		name := target.Label()
+		output.Host = target.IP
+		opts.HostIndex, opts.HostCount = i+1, len(targets)
+		if len(targets) > 1 {
+			logf("\n=== %s (%s) [%s] ===\n", name, target.IP, target.Family)
+		}
+
+		if !*pn {
+			logf("Verificando se %s está online...\n", name)
+			if !isHostAlive(target.IP, alivePorts, timeoutDuration*2) {
+				warnf("Aviso: %s (%s) parece estar offline ou inacessível.\n", name, target.IP)
+				if *skipOffline {
+					logf("Pulando host offline.\n")
+					offlineHosts++
+					report.Hosts = append(report.Hosts, JSONHost{
+						Host:    target.IP,
+						Names:   target.Names,
+						Family:  target.Family,
+						Status:  "offline",
+						Results: []PortResult{},
+					})
+					continue
+				}
+				logf("Continuando com o scan, mas resultados podem ser imprecisos.\n")
+			} else {
+				logf("Host %s (%s) está online.\n", name, target.IP)
+			}
+		}
+
+		if *bannerOnly {
+			runBannerOnly(target.IP, ports, opts)
+			continue
+		}
+
+		if *trace {
+			logf("\nRota até %s:\n", target.IP)
+			hops, err := traceroute(target.IP, ports[0], timeoutDuration)
+			if err != nil {
+				logf("Traceroute indisponível: %v\n", err)
+			}
+			for _, hop := range hops {
+				logf("  %s\n", hop)
+			}
+		}
+
+		logf("\nIniciando scan em %s (%s)\n", name, target.Address())
+		if opts.Rate > 0 {
+			logf("Escaneando %d portas com %d threads, até %d conexões/s e timeout de %s\n", len(ports), threads, opts.Rate, timeoutDuration)
 		} else {
-			readTimeout := 200 * time.Millisecond
-			err := conn.SetReadDeadline(time.Now().Add(readTimeout))
-			if err == nil {
-				buff := make([]byte, 1024)
-				_, err := conn.Read(buff)
-				if err == nil {
-					result.Service = "custom-service"
+			logf("Escaneando %d portas com %d threads e timeout de %s\n", len(ports), threads, timeoutDuration)
+		}
+		logf("Iniciando scan %s...\n", strings.ToUpper(opts.Protocol))
+		logf("\n")
+
+		hostScan := scanHost(context.Background(), target.IP, ports, opts)
+		if opts.TwoPhase && opts.Protocol == "tcp" {
+			// Os banners entram antes do -detect-tarpit, que compara os banners
+			// das portas abertas e veria todos vazios sem esta fase.
+			bannerStart := time.Now()
+			probed := grabOpenBanners(target.IP, hostScan.Results, opts)
+			mergeOpenResults(hostScan.All, hostScan.Results)
+			logf("Descoberta: %.2fs; banners de %d porta(s) aberta(s): %.2fs\n", hostScan.Stats.Elapsed, probed, time.Since(bannerStart).Seconds())
+		}
+		tarpit := *tarpitCheck && hostScan.Status == "scanned" && detectTarpit(hostScan.All)
+		if tarpit {
+			hostScan.Status = "tarpit"
+		}
+		hostScans = append(hostScans, hostScan)
+		results := hostScan.Results
+		if len(results) > 0 {
+			foundOpen = true
+		}
+		if hostScan.Status == "unreachable" {
+			warnLine("Aviso: %s inacessível (rede ou rota indisponível), %d portas restantes ignoradas.", target.IP, hostScan.Skipped)
+		} else if hostScan.Status == "tarpit" && !tarpit {
+			warnLine("Aviso: %s atingiu %d portas abertas (-max-open), provável tarpit/honeypot; %d portas restantes ignoradas.", target.IP, opts.MaxOpen, hostScan.Skipped)
+		} else if opts.FailFast && foundOpen {
+			logLine("Porta aberta encontrada (-fail-fast), %d portas restantes ignoradas.", hostScan.Skipped)
+		} else if hostScan.Skipped > 0 {
+			warnLine("Aviso: tempo limite do host atingido, %d portas não escaneadas (skipped).", hostScan.Skipped)
+		}
+		if tarpit {
+			warnLine("Aviso: %s parece ser um tarpit/honeypot: %d de %d portas abertas com banner idêntico e latência uniforme.", target.IP, len(hostScan.Results), hostScan.Scanned)
+		}
+		if looksBlackholed(hostScan.Stats) {
+			warnLine("Aviso: todas as %d portas de %s ficaram filtradas e nenhum RST foi recebido.", hostScan.Stats.States["filtered"], target.IP)
+			warnLine("  Isso costuma indicar host offline, firewall bloqueando tudo ou falha de rede, não serviços filtrados um a um.")
+			warnLine("  Confirme se o host está ativo (sem -Pn, ou com -alive-ports), tente um -timeout maior (ex: -timeout 2000) e confira rota e conectividade.")
+		}
+		if opts.Retries > 0 || opts.ResetRetries > 0 {
+			logf("%d porta(s) aberta(s) confirmada(s) após retry; %d continuaram filtradas após retry\n", hostScan.Stats.Rescued, hostScan.Stats.Retried)
+		}
+		if opts.AutoThreads {
+			logf("Concorrência final (-auto-threads): %d threads\n", hostScan.Threads)
+		}
+		if httpPaths != nil {
+			client := newHostHTTPClient(opts)
+			for i := range results {
+				if isHTTPService(results[i]) {
+					probeStart := time.Now()
+					results[i].Paths = probeHTTPPaths(client, target.IP, results[i], httpPaths, opts)
+					if results[i].Timing != nil {
+						results[i].Timing.Probe = time.Since(probeStart)
+					}
 				}
 			}
+			client.CloseIdleConnections()
+		}
+		if *verifyTLS && opts.Protocol == "tcp" {
+			verifyTLSHostnames(target.IP, target.Names[0], results, opts)
+		}
+		sortResults(results, *sortBy)
+		var osName string
+		if *osGuess {
+			var votes int
+			osName, votes = guessOS(results)
+			if osName != "" {
+				logf("SO provável (inferido dos banners, não de fingerprint): %s, citado em %d de %d portas abertas\n", osName, votes, len(results))
+			} else {
+				logf("SO provável (inferido dos banners): nenhuma pista nos banners coletados\n")
+			}
+		}
+		shown := filterServices(results, serviceFilter)
+		runPostScanHooks(target.IP, shown)
+		var added, missing []int
+		if baseline != nil {
+			added, missing = baselineDiff(baseline, target.IP, ports, results)
+		}
+		if *portsOnly {
+			fmt.Println(formatPortsOnly(target.IP, shown))
+		} else if *greppableClosed {
+			for _, line := range formatGreppable(target.IP, opts.Protocol, filterServices(hostScan.All, serviceFilter)) {
+				fmt.Println(line)
+			}
+		} else if *greppable {
+			for _, line := range formatGreppable(target.IP, opts.Protocol, shown) {
+				fmt.Println(line)
+			}
+		} else if *countOnly {
+			fmt.Println(formatCount(target.IP, shown, len(targets) > 1))
+		} else if *jsonOut {
+			report.Hosts = append(report.Hosts, JSONHost{
+				Host:     target.IP,
+				Names:    target.Names,
+				Family:   target.Family,
+				Status:   hostScan.Status,
+				Results:  jsonBanners(shown),
+				Stats:    hostScan.Stats,
+				OSGuess:  osName,
+				PTR:      target.PTR,
+				New:      added,
+				Missing:  missing,
+				Filtered: hostScan.Filtered,
+			})
+			report.Stats.merge(hostScan.Stats)
+		} else if tarpit && !*jsonl {
+			logf("Lista de portas omitida para o provável tarpit (use -json para vê-la).\n")
+		} else if !*jsonl && !*matrix && !asserting {
+			printResults(shown, hostScan, output)
+			if opts.TimingDebug {
+				printTimings(shown)
+			}
+			if opts.TCPDetails {
+				printTCPDetails(shown)
+			}
+			if *verifyTLS {
+				printTLSChecks(shown)
+			}
+			if opts.ConfirmOf > 1 {
+				printConfidence(shown)
+			}
+			if baseline != nil {
+				printBaselineDiff(added, missing)
+			}
+		}
+
+		if *detectFlapping {
+			logf("\nAguardando %s para a segunda passagem...\n", *flapDelay)
+			time.Sleep(*flapDelay)
+			// A segunda passagem só alimenta a comparação: sem OnResult ela
+			// não repete registros -jsonl, callbacks, syslog nem avisos NEW.
+			recheck := opts
+			recheck.OnResult = nil
+			showProgress := progress
+			progress = false
+			second := scanHost(context.Background(), target.IP, ports, recheck)
+			progress = showProgress
+			printFlapping(diffScans(hostScan.All, second.All))
+		}
+
+		if expectedPorts != nil && reportExpected(results, expectedPorts) {
+			discrepancies = true
+		}
+		for _, failure := range checkAssertions(results, assertOpenPorts, assertClosedPorts) {
+			assertFailures = append(assertFailures, target.IP+": "+failure)
+		}
+
+		if opts.FailFast && foundOpen {
+			break
+		}
+	}
+
+	if callback != nil {
+		callback.Close()
+	}
+
+	if *matrix {
+		fmt.Println()
+		for _, line := range formatMatrix(hostScans, ports) {
+			fmt.Println(line)
+		}
+	}
+
+	if *rollup {
+		printRollup(hostScans)
+	}
+
+	if offlineHosts > 0 {
+		logf("\n%d host(s) offline não escaneado(s).\n", offlineHosts)
+	}
+
+	logf("\nScan completo em %.2f segundos\n", time.Since(startTime).Seconds())
+
+	if *jsonOut {
+		report.Stats.finish(time.Since(startTime))
+		var data []byte
+		var err error
+		if *jsonPretty {
+			data, err = json.MarshalIndent(report, "", "  ")
+		} else {
+			data, err = json.Marshal(report)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Erro ao gerar JSON:", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+	}
+
+	if asserting {
+		if len(assertFailures) > 0 {
+			fmt.Printf("ARGOS CRITICAL - %s\n", strings.Join(assertFailures, "; "))
+			os.Exit(exitCritical)
+		}
+		fmt.Printf("ARGOS OK - %d asserção(ões) atendida(s) em %d host(s)\n", len(assertOpenPorts)+len(assertClosedPorts), len(hostScans))
+	}
+	if discrepancies {
+		os.Exit(exitDiscrepancy)
+	}
+	if opts.FailFast && !foundOpen {
+		os.Exit(exitNoOpenPorts)
+	}
+}
+
+type ServiceCount struct {
+	Service string
+	Hosts   int
+}
+
+func rollupServices(scans []HostScan) []ServiceCount {
+	counts := make(map[string]int)
+	for _, scan := range scans {
+		seen := make(map[string]bool)
+		for _, r := range scan.Results {
+			if r.State == "open" && !seen[r.Service] {
+				seen[r.Service] = true
+				counts[r.Service]++
+			}
+		}
+	}
+
+	rollup := make([]ServiceCount, 0, len(counts))
+	for service, hosts := range counts {
+		rollup = append(rollup, ServiceCount{Service: service, Hosts: hosts})
+	}
+	sort.Slice(rollup, func(i, j int) bool {
+		if rollup[i].Hosts != rollup[j].Hosts {
+			return rollup[i].Hosts > rollup[j].Hosts
+		}
+		return rollup[i].Service < rollup[j].Service
+	})
+	return rollup
+}
+
+func printRollup(scans []HostScan) {
+	rollup := rollupServices(scans)
+	if len(rollup) == 0 {
+		return
+	}
+
+	logf("\nSERVIÇOS (%d hosts escaneados)\n", len(scans))
+	for _, sc := range rollup {
+		logf("%s: %d host(s)\n", sc.Service, sc.Hosts)
+	}
+}
+
+// formatMatrix monta a grade do -matrix: uma linha por host escaneado e uma
+// coluna por porta, com o estado de cada par, e ao final quantos hosts têm
+// cada porta aberta. Portas não escaneadas (host inacessível) ficam com "-".
+func formatMatrix(scans []HostScan, ports []int) []string {
+	columns := append([]int(nil), ports...)
+	sort.Ints(columns)
+
+	header := []string{"HOST"}
+	for _, port := range columns {
+		header = append(header, strconv.Itoa(port))
+	}
+	lines := []string{strings.Join(header, "\t")}
+
+	open := make(map[int]int)
+	for _, scan := range scans {
+		states := make(map[int]string)
+		for _, r := range scan.All {
+			states[r.Port] = r.State
+		}
+		row := []string{scan.IP}
+		for _, port := range columns {
+			state := states[port]
+			switch state {
+			case "open":
+				open[port]++
+			case "", "skipped":
+				state = "-"
+			}
+			row = append(row, state)
+		}
+		lines = append(lines, strings.Join(row, "\t"))
+	}
+
+	footer := []string{"ABERTAS"}
+	for _, port := range columns {
+		footer = append(footer, fmt.Sprintf("%d/%d", open[port], len(scans)))
+	}
+	return append(lines, strings.Join(footer, "\t"))
+}
+
+// loadReport lê um relatório gerado com -json.
+func loadReport(path string) (JSONReport, error) {
+	var report JSONReport
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return report, fmt.Errorf("não foi possível ler %s: %v", path, err)
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return report, fmt.Errorf("%s não é um relatório -json válido: %v", path, err)
+	}
+	return report, nil
+}
+
+// loadBaseline lê um relatório -json anterior e devolve as portas abertas
+// como um conjunto de chaves host:porta.
+func loadBaseline(path string) (map[string]bool, error) {
+	report, err := loadReport(path)
+	if err != nil {
+		return nil, err
+	}
+	open := make(map[string]bool)
+	for _, h := range report.Hosts {
+		for _, r := range h.Results {
+			if r.State == "open" {
+				open[net.JoinHostPort(h.Host, strconv.Itoa(r.Port))] = true
+			}
+		}
+	}
+	return open, nil
+}
+
+// baselineDiff compara as portas abertas do host com o baseline: added são
+// as abertas que não estavam lá e missing as que estavam abertas e, entre as
+// portas escaneadas agora, não estão mais.
+func baselineDiff(baseline map[string]bool, host string, scanned []int, results []PortResult) (added, missing []int) {
+	open := make(map[int]bool)
+	for _, r := range results {
+		if r.State != "open" {
+			continue
+		}
+		open[r.Port] = true
+		if !baseline[net.JoinHostPort(host, strconv.Itoa(r.Port))] {
+			added = append(added, r.Port)
+		}
+	}
+	for _, port := range scanned {
+		if baseline[net.JoinHostPort(host, strconv.Itoa(port))] && !open[port] {
+			missing = append(missing, port)
+		}
+	}
+	sort.Ints(added)
+	sort.Ints(missing)
+	return added, missing
+}
+
+func printBaselineDiff(added, missing []int) {
+	if len(added) == 0 && len(missing) == 0 {
+		fmt.Println("\nBaseline: nenhuma mudança nas portas abertas.")
+		return
+	}
+	fmt.Println("\nBASELINE")
+	for _, port := range added {
+		fmt.Printf("NOVA\t%d\n", port)
+	}
+	for _, port := range missing {
+		fmt.Printf("AUSENTE\t%d\n", port)
+	}
+}
+
+// rescanFiltered reescaneia as portas filtradas de cada host do relatório e
+// incorpora o resultado a ele: as portas que responderam saem de Filtered,
+// as abertas entram em Results e as contagens de estado são corrigidas. As
+// mudanças voltam por host.
+func rescanFiltered(ctx context.Context, report *JSONReport, opts ScanOptions) map[string][]PortChange {
+	opts.KeepAll = true
+	changes := make(map[string][]PortChange)
+	for i := range report.Hosts {
+		h := &report.Hosts[i]
+		if len(h.Filtered) == 0 {
+			continue
+		}
+		scan := scanHost(ctx, h.Host, h.Filtered, opts)
+		answered := make(map[int]bool)
+		for _, r := range scan.All {
+			if r.State == "filtered" || r.State == "skipped" {
+				continue
+			}
+			answered[r.Port] = true
+			changes[h.Host] = append(changes[h.Host], PortChange{Port: r.Port, Before: "filtered", After: r.State})
+			h.Stats.reclassify("filtered", r.State)
+			report.Stats.reclassify("filtered", r.State)
+			if r.State == "open" {
+				h.Results = append(h.Results, jsonBanners([]PortResult{r})[0])
+			}
+		}
+		var still []int
+		for _, port := range h.Filtered {
+			if !answered[port] {
+				still = append(still, port)
+			}
+		}
+		h.Filtered = still
+		sort.Slice(h.Results, func(a, b int) bool {
+			return h.Results[a].Port < h.Results[b].Port
+		})
+	}
+	return changes
+}
+
+func printRescan(report JSONReport, changes map[string][]PortChange) {
+	var remaining int
+	for _, h := range report.Hosts {
+		remaining += len(h.Filtered)
+		if len(changes[h.Host]) == 0 {
+			continue
+		}
+		fmt.Printf("\n%s\n", h.Host)
+		fmt.Println("PORTA\tANTES\tDEPOIS")
+		for _, c := range changes[h.Host] {
+			fmt.Printf("%d\t%s\t%s\n", c.Port, c.Before, c.After)
+		}
+	}
+	if len(changes) == 0 {
+		fmt.Println("Nenhuma porta filtrada respondeu no reescaneamento.")
+	}
+	fmt.Printf("\n%d porta(s) seguem filtradas.\n", remaining)
+}
+
+type PortChange struct {
+	Port   int
+	Before string
+	After  string
+}
+
+// diffScans compara as duas passagens por porta; uma porta que seguiu
+// aberta mas mudou de banner também conta como mudança.
+func diffScans(first, second []PortResult) []PortChange {
+	before := make(map[int]PortResult)
+	for _, r := range first {
+		before[r.Port] = r
+	}
+
+	var changes []PortChange
+	for _, r := range second {
+		prev, ok := before[r.Port]
+		switch {
+		case !ok:
+		case prev.State != r.State:
+			changes = append(changes, PortChange{Port: r.Port, Before: prev.State, After: r.State})
+		case r.State == "open" && prev.BannerHash != r.BannerHash:
+			changes = append(changes, PortChange{Port: r.Port, Before: "open, banner " + prev.BannerHash, After: "open, banner " + r.BannerHash})
+		}
+	}
+	return changes
+}
+
+// looksBlackholed indica um resultado praticamente todo filtrado sem nenhum
+// RST: quase sempre é o host ou a rede, não cada serviço filtrado.
+func looksBlackholed(stats ScanStats) bool {
+	filtered := stats.States["filtered"]
+	return filtered > 0 && stats.States["closed"] == 0 && stats.States["open"] == 0 &&
+		float64(filtered) >= float64(stats.Total-stats.States["skipped"])*allFilteredRatio
+}
+
+// detectTarpit reconhece hosts que aceitam praticamente qualquer conexão:
+// quase todas as portas sondadas abertas, com o mesmo banner e latências
+// parecidas (coeficiente de variação baixo), como um único processo faria.
+func detectTarpit(results []PortResult) bool {
+	var open []PortResult
+	probed := 0
+	for _, r := range results {
+		if r.State == "skipped" {
+			continue
+		}
+		probed++
+		if r.State == "open" {
+			open = append(open, r)
+		}
+	}
+	if probed < tarpitMinPorts || float64(len(open)) < float64(probed)*tarpitOpenRatio {
+		return false
+	}
+
+	var sum float64
+	for _, r := range open {
+		if r.Banner != open[0].Banner {
+			return false
+		}
+		sum += float64(r.Latency)
+	}
+	mean := sum / float64(len(open))
+	var variance float64
+	for _, r := range open {
+		d := float64(r.Latency) - mean
+		variance += d * d
+	}
+	variance /= float64(len(open))
+	return mean == 0 || math.Sqrt(variance)/mean < tarpitLatencyCV
+}
+
+func printFlapping(changes []PortChange) {
+	if len(changes) == 0 {
+		logf("\nNenhuma porta mudou de estado entre as passagens.\n")
+		return
+	}
+
+	logf("\nPORTAS COM MUDANÇA DE ESTADO\n")
+	logf("PORTA\t1ª PASSAGEM\t2ª PASSAGEM\n")
+	for _, c := range changes {
+		logf("%d\t%s\t%s\n", c.Port, c.Before, c.After)
+	}
+}
+
+func parseServiceFilter(list string) map[string]bool {
+	if list == "" {
+		return nil
+	}
+	filter := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			filter[strings.ToLower(name)] = true
+		}
+	}
+	return filter
+}
+
+func filterServices(results []PortResult, filter map[string]bool) []PortResult {
+	if filter == nil {
+		return results
+	}
+	filtered := make([]PortResult, 0, len(results))
+	for _, r := range results {
+		if filter[strings.ToLower(r.Service)] {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered
+}
+
+func sortResults(results []PortResult, by string) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		switch by {
+		case "latency":
+			if a.Latency != b.Latency {
+				return a.Latency > b.Latency
+			}
+		case "service":
+			if a.Service != b.Service {
+				return a.Service < b.Service
+			}
+		case "state":
+			if a.State != b.State {
+				return a.State < b.State
+			}
+		}
+		return a.Port < b.Port
+	})
+}
+
+func compareExpected(results []PortResult, expected []int) (unexpected, missing []int) {
+	open := make(map[int]bool)
+	for _, r := range results {
+		if r.State == "open" {
+			open[r.Port] = true
+		}
+	}
+
+	expectedSet := make(map[int]bool)
+	for _, port := range expected {
+		expectedSet[port] = true
+		if !open[port] {
+			missing = append(missing, port)
 		}
-	} else {
-		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-			result.State = "filtered"
+	}
+
+	for _, r := range results {
+		if r.State == "open" && !expectedSet[r.Port] {
+			unexpected = append(unexpected, r.Port)
 		}
 	}
 
-	return result
+	return unexpected, missing
 }
 
-func isHostAlive(host string, timeout time.Duration) bool {
-	for _, port := range []int{80, 443} {
-		address := fmt.Sprintf("%s:%d", host, port)
-		conn, err := net.DialTimeout("tcp", address, timeout)
-		if err == nil {
-			conn.Close()
-			return true
-		}
+func reportExpected(results []PortResult, expected []int) bool {
+	unexpected, missing := compareExpected(results, expected)
+
+	if len(unexpected) == 0 && len(missing) == 0 {
+		logf("\nNenhuma divergência em relação às portas esperadas.\n")
+		return false
 	}
 
-	cmd := exec.Command("ping", "-c", "1", "-W", "2", host)
-	err := cmd.Run()
-	return err == nil
+	if len(unexpected) > 0 {
+		logf("\n[!] Portas abertas inesperadas: %s\n", joinPorts(unexpected))
+	}
+	if len(missing) > 0 {
+		logf("\n[!] Portas esperadas que não estão abertas: %s\n", joinPorts(missing))
+	}
+	return true
 }
 
-func main() {
-	for _, arg := range os.Args[1:] {
-		if arg == "-help" || arg == "--help" || arg == "-h" {
-			showCustomHelp()
-			return
+// checkAssertions confere o -assert-open/-assert-closed de um host; filtrada
+// conta como fechada, já que a porta não aceita conexões.
+func checkAssertions(results []PortResult, wantOpen, wantClosed []int) []string {
+	open := make(map[int]bool)
+	for _, r := range results {
+		if r.State == "open" {
+			open[r.Port] = true
 		}
 	}
 
-	var (
-		portRange string
-		host      string
-		threads   int
-		timeout   int
-		verbose   bool
-	)
-
-	flag.StringVar(&host, "host", "", "Host para escanear (obrigatório)")
-	flag.StringVar(&portRange, "p", "1-1024", "Range de portas para escanear (ex: 22,80,100-200)")
-	flag.IntVar(&threads, "t", defaultThreads, "Número de threads concorrentes")
-	flag.IntVar(&timeout, "timeout", int(defaultTimeout/time.Millisecond), "Timeout em milissegundos")
-	flag.BoolVar(&verbose, "v", false, "Modo verbose - exibe mais informações")
-	useIPv4 := flag.Bool("4", true, "Usar apenas IPv4")
-	pn := flag.Bool("Pn", false, "Pular host discovery (assume host online)")
+	var failures []string
+	for _, port := range wantOpen {
+		if !open[port] {
+			failures = append(failures, fmt.Sprintf("porta %d não está aberta", port))
+		}
+	}
+	for _, port := range wantClosed {
+		if open[port] {
+			failures = append(failures, fmt.Sprintf("porta %d está aberta", port))
+		}
+	}
+	return failures
+}
 
-	flag.Usage = showCustomHelp
-	flag.Parse()
+func joinPorts(ports []int) string {
+	parts := make([]string, len(ports))
+	for i, port := range ports {
+		parts[i] = strconv.Itoa(port)
+	}
+	return strings.Join(parts, ",")
+}
 
-	if host == "" {
-		fmt.Print("Digite o host para escanear: ")
-		fmt.Scanln(&host)
+func mergePorts(ports, extra []int) []int {
+	seen := make(map[int]bool)
+	for _, port := range ports {
+		seen[port] = true
+	}
+	for _, port := range extra {
+		if !seen[port] {
+			seen[port] = true
+			ports = append(ports, port)
+		}
 	}
+	return ports
+}
 
-	resolvedIP, err := validateHost(host)
-	if err != nil {
-		fmt.Println("Erro:", err)
-		os.Exit(1)
+func (opts ScanOptions) probeTimeout() time.Duration {
+	if opts.ProbeTimeout > 0 {
+		return opts.ProbeTimeout
 	}
+	return bannerReadTimeout
+}
 
-	timeoutDuration := time.Duration(timeout) * time.Millisecond
+type pacer struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
 
-	if !*pn {
-		fmt.Printf("Verificando se %s está online...\n", host)
-		if !isHostAlive(resolvedIP, timeoutDuration*2) {
-			fmt.Printf("Aviso: %s (%s) parece estar offline ou inacessível.\n", host, resolvedIP)
-			fmt.Println("Continuando com o scan, mas resultados podem ser imprecisos.")
-		} else {
-			fmt.Printf("Host %s (%s) está online.\n", host, resolvedIP)
-		}
+func newPacer(rate int) *pacer {
+	if rate <= 0 {
+		return nil
 	}
+	return &pacer{interval: time.Second / time.Duration(rate)}
+}
 
-	if *useIPv4 && !strings.Contains(resolvedIP, ".") {
-		fmt.Println("Forçando uso de IPv4, mas apenas endereço IPv6 disponível. Tentando re-resolver...")
-		addrs, err := net.LookupHost(host)
-		if err == nil {
-			for _, addr := range addrs {
-				if net.ParseIP(addr).To4() != nil {
-					resolvedIP = addr
-					fmt.Printf("Usando endereço IPv4: %s\n", resolvedIP)
-					break
-				}
-			}
-		}
+func (p *pacer) Wait() {
+	if p == nil {
+		return
 	}
+	p.mu.Lock()
+	start := time.Now()
+	if p.next.After(start) {
+		start = p.next
+	}
+	p.next = start.Add(p.interval)
+	p.mu.Unlock()
 
-	ports, err := parsePortRange(portRange)
-	if err != nil {
-		fmt.Println("Erro no range de portas:", err)
-		os.Exit(1)
+	time.Sleep(time.Until(start))
+}
+
+// threadGate limita quantos workers do pool podem pegar portas. O
+// -auto-threads e a proteção contra SYNs descartados ajustam o limite durante
+// o scan; workers acima dele terminam a porta atual e aguardam até o limite
+// voltar a subir.
+type threadGate struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	limit int
+}
+
+func newThreadGate(limit int) *threadGate {
+	g := &threadGate{limit: limit}
+	g.cond = sync.NewCond(&g.mu)
+	return g
+}
+
+func (g *threadGate) Wait(id int) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	for id >= g.limit {
+		g.cond.Wait()
 	}
+	g.mu.Unlock()
+}
 
-	if len(ports) == 0 {
-		for i := 1; i <= 1024; i++ {
-			ports = append(ports, i)
-		}
+func (g *threadGate) Limit() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.limit
+}
+
+func (g *threadGate) SetLimit(limit int) {
+	g.mu.Lock()
+	g.limit = limit
+	g.mu.Unlock()
+	g.cond.Broadcast()
+}
+
+// adjust aplica um passo do controle do -auto-threads: recua pela metade
+// quando muitas portas expiram e cresce 50% enquanto o alvo responde bem.
+func (g *threadGate) adjust(total, failed int64, max int) {
+	if total == 0 {
+		return
+	}
+	limit := g.Limit()
+	ratio := float64(failed) / float64(total)
+	switch {
+	case ratio > autoThreadsBackoff && limit > 1:
+		g.SetLimit(limit / 2)
+	case ratio < autoThreadsRampUp && limit < max:
+		g.SetLimit(min(max, limit+limit/2+1))
 	}
+}
 
-	fmt.Printf("\nIniciando scan em %s (%s)\n", host, resolvedIP)
-	fmt.Printf("Escaneando %d portas com %d threads e timeout de %dms\n", len(ports), threads, timeout)
-	fmt.Println("Iniciando scan TCP...\n")
-	startTime := time.Now()
+// prioritizeOSPorts move para a frente as portas típicas do SO inferido,
+// mantendo a ordem relativa das demais.
+func prioritizeOSPorts(ports []int, guess string) {
+	family := "Unix"
+	if guess == "Windows" {
+		family = "Windows"
+	}
+	preferred := make(map[int]bool)
+	for _, port := range osTopPorts[family] {
+		preferred[port] = true
+	}
+	sort.SliceStable(ports, func(i, j int) bool {
+		return preferred[ports[i]] && !preferred[ports[j]]
+	})
+}
+
+func scanHost(ctx context.Context, ip string, ports []int, opts ScanOptions) HostScan {
+	if opts.OSWeighted {
+		ports = append([]int(nil), ports...)
+	}
+	if opts.HostTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.HostTimeout)
+		defer cancel()
+	}
+	ctx, stop := context.WithCancelCause(ctx)
+	defer stop(nil)
+	status := "scanned"
 
 	var wg sync.WaitGroup
+	var scanned, open, window, failed, fastClosed, inflight int64
+	skipped, answered, hostUnreach := 0, 0, 0
+	stats := newScanStats()
+	startTime := time.Now()
 	results := make([]PortResult, 0)
+	var all, events []PortResult
+	samples := make(map[string][]int)
+	var filtered []int
+	var osHint atomic.Value
 	resultsChan := make(chan PortResult)
 	done := make(chan bool)
-	sem := make(chan struct{}, threads)
+	jobs := make(chan int)
 
 	go func() {
 		for result := range resultsChan {
+			stats.record(result)
+			if opts.KeepAll {
+				all = append(all, result)
+			}
+			// EHOSTUNREACH também é o que o Linux devolve para rejeições ICMP
+			// admin/host-prohibited (o REJECT padrão do firewalld), e um
+			// ENETUNREACH isolado pode ser só uma rota oscilando, então só
+			// encerra o host se as primeiras respostas forem todas assim.
+			if (result.Reason == "host-unreach" || result.Reason == "net-unreach") && hostUnreach == answered {
+				hostUnreach++
+			}
+			if result.State != "skipped" {
+				answered++
+			}
+			if status == "scanned" && hostUnreach >= hostUnreachMinResults {
+				status = "unreachable"
+				stop(errHostUnreachable)
+			}
+			if result.State == "skipped" {
+				skipped++
+				continue
+			}
+			if (result.State == "closed" || result.State == "filtered") && len(samples[result.State]) < closedSampleSize {
+				samples[result.State] = append(samples[result.State], result.Port)
+			}
+			if result.State == "filtered" {
+				filtered = append(filtered, result.Port)
+			}
+			if n := atomic.AddInt64(&scanned, 1); progress && n%100 == 0 {
+				logf("%s", progressLine(ip, int(n), len(ports), opts))
+			}
+			atomic.AddInt64(&window, 1)
+			if result.State == "filtered" {
+				atomic.AddInt64(&failed, 1)
+			}
+			if result.Reason == "conn-refused" && result.Latency < opts.Timeout/10 {
+				atomic.AddInt64(&fastClosed, 1)
+			}
 			if result.State == "open" {
+				atomic.AddInt64(&open, 1)
 				results = append(results, result)
-				if verbose {
-					fmt.Printf("\rPorta %d: %s (%s)          \n", result.Port, result.State, result.Service)
+				if opts.OSWeighted && osHint.Load() == nil {
+					if guess, _ := guessOS(results); guess != "" {
+						osHint.Store(guess)
+					}
+				}
+				if opts.FailFast {
+					stop(errFoundOpen)
+				}
+				if opts.MaxOpen > 0 && atomic.LoadInt64(&open) == int64(opts.MaxOpen) && status == "scanned" {
+					status = "tarpit"
+					stop(errMaxOpen)
+				}
+				if opts.OnResult != nil {
+					opts.OnResult(ip, result)
 				}
-			} else if verbose && result.State == "filtered" {
-				fmt.Printf("\rPorta %d: filtrada          \n", result.Port)
+			}
+			if !opts.Verbose || (result.State != "open" && result.State != "filtered") {
+				continue
+			}
+			if opts.GroupVerbose {
+				events = append(events, result)
+			} else {
+				logVerbose(result)
 			}
 		}
 		done <- true
 	}()
 
-	for _, port := range ports {
-		wg.Add(1)
-		sem <- struct{}{}
+	stopStats := make(chan struct{})
+	if opts.StatsEvery > 0 {
+		go func() {
+			ticker := time.NewTicker(opts.StatsEvery)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					n := atomic.LoadInt64(&scanned)
+					logLine("[%s] %d/%d portas (%.1f%%), %d abertas, %.1f portas/s",
+						time.Now().Format("15:04:05"), n, len(ports), float64(n)/float64(len(ports))*100,
+						atomic.LoadInt64(&open), float64(n)/time.Since(startTime).Seconds())
+				case <-stopStats:
+					return
+				}
+			}
+		}()
+	}
 
-		go func(p int) {
-			defer wg.Done()
-			defer func() { <-sem }()
+	limiter := newPacer(opts.Rate)
+	var gate *threadGate
+	if opts.AutoThreads {
+		gate = newThreadGate(min(autoThreadsStart, opts.Threads))
+		go func() {
+			ticker := time.NewTicker(autoThreadsInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					gate.adjust(atomic.SwapInt64(&window, 0), atomic.SwapInt64(&failed, 0), opts.Threads)
+				case <-stopStats:
+					return
+				}
+			}
+		}()
+	} else if opts.NoSynBackoff {
+		gate = newThreadGate(math.MaxInt)
+	} else {
+		// Sem -auto-threads, o pool só recua quando os timeouts disparam depois
+		// de um período estável: sinal de SYNs descartados pelo kernel ou por
+		// um firewall, e não de portas filtradas desde o início. Janelas calmas
+		// devolvem as threads aos poucos; se os timeouts não cedem mesmo no
+		// mínimo, são portas filtradas e o limite volta de uma vez.
+		gate = newThreadGate(math.MaxInt)
+		go func() {
+			ticker := time.NewTicker(autoThreadsInterval)
+			defer ticker.Stop()
+			calm, throttled := false, false
+			stuck := 0
+			for {
+				select {
+				case <-ticker.C:
+					total, dropped := atomic.SwapInt64(&window, 0), atomic.SwapInt64(&failed, 0)
+					if total < synDropMinResults {
+						continue
+					}
+					ratio := float64(dropped) / float64(total)
+					if ratio < autoThreadsRampUp {
+						calm, stuck = true, 0
+						if !throttled {
+							continue
+						}
+						limit := gate.Limit() * 2
+						if limit >= opts.Threads {
+							limit, throttled = math.MaxInt, false
+							logLine("Timeouts normalizados, concorrência restaurada para %d threads", opts.Threads)
+						}
+						gate.SetLimit(limit)
+					} else if (calm || throttled) && ratio > synDropSpike {
+						limit := max(autoThreadsStart, int(atomic.LoadInt64(&inflight))/2)
+						if limit < gate.Limit() {
+							gate.SetLimit(limit)
+							calm, throttled, stuck = false, true, 0
+							warnLine("Aviso: possível limitação do kernel/firewall detectada (%.0f%% de timeouts), reduzindo para %d threads", ratio*100, limit)
+							continue
+						}
+						if throttled {
+							stuck++
+							if stuck >= synDropStuckWindows {
+								logLine("Timeouts continuam com %d threads: portas filtradas, não limitação; concorrência restaurada para %d threads", gate.Limit(), opts.Threads)
+								gate.SetLimit(math.MaxInt)
+								throttled, stuck = false, 0
+							}
+						}
+					}
+				case <-stopStats:
+					return
+				}
+			}
+		}()
+	}
+	worker := func(id int) {
+		defer wg.Done()
+		gate.Wait(id)
+		for p := range jobs {
+			limiter.Wait()
 
-			result := scanPort(resolvedIP, p, timeoutDuration)
+			atomic.AddInt64(&inflight, 1)
+			result := scanPortSafe(ctx, ip, p, opts)
+			atomic.AddInt64(&inflight, -1)
 			resultsChan <- result
+			gate.Wait(id)
+		}
+	}
+
+	workers := opts.Threads
+	if workers > len(ports) {
+		workers = len(ports)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go worker(i)
+	}
+
+	maxWorkers := workers
+	var minInterval time.Duration
+	if opts.MinRate > 0 {
+		maxWorkers = opts.Threads * minRateBurstFactor
+		minInterval = time.Second / time.Duration(opts.MinRate)
+	}
 
-			if p%100 == 0 {
-				fmt.Printf("\rEscaneando... %.1f%% concluído", float64(p)/float64(len(ports))*100)
+	launched := 0
+
+	fastMax := workers
+	if opts.FastClosed {
+		fastMax = opts.Threads * fastClosedBurstFactor
+	}
+
+	reordered := false
+
+dispatch:
+	for i := 0; i < len(ports); i++ {
+		if guess, ok := osHint.Load().(string); ok && !reordered {
+			reordered = true
+			prioritizeOSPorts(ports[i:], guess)
+			if opts.Verbose {
+				logLine("%s parece %s, priorizando as portas típicas desse sistema", ip, guess)
+			}
+		}
+		port := ports[i]
+		if launched > 0 && launched%fastClosedCheckEvery == 0 && workers < fastMax {
+			n := atomic.LoadInt64(&scanned)
+			if n > 0 && float64(atomic.LoadInt64(&fastClosed)) >= float64(n)*fastClosedRatio {
+				grow := min(fastMax, workers*2)
+				if opts.Verbose {
+					logLine("%s recusa conexões de imediato (%d de %d portas), ampliando de %d para %d threads", ip, atomic.LoadInt64(&fastClosed), n, workers, grow)
+				}
+				for workers < grow {
+					wg.Add(1)
+					go worker(workers)
+					workers++
+				}
 			}
-		}(port)
+		}
+
+		if minInterval > 0 {
+			timer := time.NewTimer(minInterval)
+			select {
+			case jobs <- port:
+				timer.Stop()
+				launched++
+				continue
+			case <-ctx.Done():
+				timer.Stop()
+				break dispatch
+			case <-timer.C:
+			}
+			if workers < maxWorkers {
+				wg.Add(1)
+				go worker(workers)
+				workers++
+			}
+		}
+
+		select {
+		case jobs <- port:
+			launched++
+		case <-ctx.Done():
+			break dispatch
+		}
 	}
+	close(jobs)
 
+	threads := min(gate.Limit(), workers)
+	gate.SetLimit(workers)
 	wg.Wait()
 	close(resultsChan)
 	<-done
+	close(stopStats)
+
+	skipped += len(ports) - launched
+	for i := launched; i < len(ports); i++ {
+		stats.record(PortResult{Port: ports[i], State: "skipped"})
+	}
+	stats.finish(time.Since(startTime))
+
+	if len(events) > 0 {
+		sort.Slice(events, func(i, j int) bool {
+			return events[i].Port < events[j].Port
+		})
+		logLine("== %s: %d porta(s) ==", ip, len(events))
+		for _, result := range events {
+			logVerbose(result)
+		}
+	}
 
 	sort.Slice(results, func(i, j int) bool {
 		return results[i].Port < results[j].Port
 	})
 
-	fmt.Printf("\r                                                           \r")
-	fmt.Println("\nPortas escaneadas:", len(ports))
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Port < all[j].Port
+	})
+	sort.Ints(filtered)
+
+	return HostScan{
+		IP:       ip,
+		Results:  results,
+		All:      all,
+		Scanned:  len(ports) - skipped,
+		Skipped:  skipped,
+		Stats:    stats,
+		Status:   status,
+		Threads:  threads,
+		Samples:  samples,
+		Filtered: filtered,
+	}
+}
+
+func logVerbose(result PortResult) {
+	if result.State == "filtered" {
+		logLine("Porta %d: filtrada (%s)", result.Port, result.Reason)
+	} else {
+		logLine("Porta %d: %s (%s)%s", result.Port, result.State, result.Service, hashSuffix(result.BannerHash))
+	}
+}
+
+func hashSuffix(hash string) string {
+	if hash == "" {
+		return ""
+	}
+	return " [banner " + hash + "]"
+}
+
+// formatPortsOnly omite o run ID de propósito: a linha é só "ip: portas".
+func formatPortsOnly(ip string, results []PortResult) string {
+	var open []int
+	for _, r := range results {
+		if r.State == "open" {
+			open = append(open, r.Port)
+		}
+	}
+	return fmt.Sprintf("%s: %s", ip, joinPorts(open))
+}
+
+// formatGreppable gera uma linha por porta com campos rotulados e separados
+// por tab, para que grep/awk filtrem por estado sem ambiguidade.
+func formatGreppable(ip, protocol string, results []PortResult) []string {
+	lines := make([]string, 0, len(results))
+	for _, r := range results {
+		lines = append(lines, fmt.Sprintf("Host: %s\tPort: %d/%s\tState: %s\tService: %s\tReason: %s\tRunID: %s",
+			ip, r.Port, protocol, r.State, r.Service, r.Reason, runID))
+	}
+	return lines
+}
+
+func formatCount(ip string, results []PortResult, multiHost bool) string {
+	open := 0
+	for _, r := range results {
+		if r.State == "open" {
+			open++
+		}
+	}
+	if multiHost {
+		return fmt.Sprintf("%s: %d", ip, open)
+	}
+	return strconv.Itoa(open)
+}
+
+// sampleTargets reduz os alvos a n: os primeiros ou, com rng, n sorteados,
+// mantidos na ordem original.
+func sampleTargets(targets []ScanTarget, n int, rng *rand.Rand) []ScanTarget {
+	if n >= len(targets) {
+		return targets
+	}
+	if rng == nil {
+		return targets[:n]
+	}
+	picked := rng.Perm(len(targets))[:n]
+	sort.Ints(picked)
+	sample := make([]ScanTarget, n)
+	for i, idx := range picked {
+		sample[i] = targets[idx]
+	}
+	return sample
+}
+
+// sortTargets ordena os alvos por endereço (IPv4 antes de IPv6) para que a
+// tabela com coluna HOST saia ordenada por host e depois por porta.
+func sortTargets(targets []ScanTarget) {
+	sort.SliceStable(targets, func(i, j int) bool {
+		a, b := net.ParseIP(targets[i].IP), net.ParseIP(targets[j].IP)
+		if a == nil || b == nil {
+			return targets[i].IP < targets[j].IP
+		}
+		if (a.To4() == nil) != (b.To4() == nil) {
+			return a.To4() != nil
+		}
+		return bytes.Compare(a.To16(), b.To16()) < 0
+	})
+}
+
+// reasonText é o motivo exibido pelo -reason, com as novas tentativas quando
+// houve, ex.: "no-response after 2 retries".
+func (r PortResult) reasonText() string {
+	switch {
+	case r.Retries == 1:
+		return r.Reason + " after 1 retry"
+	case r.Retries > 1:
+		return fmt.Sprintf("%s after %d retries", r.Reason, r.Retries)
+	}
+	return r.Reason
+}
+
+// reasonRows acrescenta às portas abertas as fechadas e filtradas, para que o
+// -reason explique também esses estados. Um estado com muitas portas vira uma
+// linha de resumo por motivo, como o "Not shown" do nmap.
+func reasonRows(open, all []PortResult) ([]PortResult, []string) {
+	counts := make(map[string]int)
+	for _, r := range all {
+		if r.State != "open" && r.State != "skipped" {
+			counts[r.State]++
+		}
+	}
+
+	rows := append([]PortResult(nil), open...)
+	collapsed := make(map[string]int)
+	var keys []string
+	for _, r := range all {
+		if r.State == "open" || r.State == "skipped" {
+			continue
+		}
+		if counts[r.State] <= reasonCollapseMin {
+			rows = append(rows, r)
+			continue
+		}
+		key := r.State + " (" + r.reasonText() + ")"
+		if collapsed[key] == 0 {
+			keys = append(keys, key)
+		}
+		collapsed[key]++
+	}
+
+	hidden := make([]string, len(keys))
+	for i, key := range keys {
+		hidden[i] = fmt.Sprintf("Não exibidas: %d porta(s) %s", collapsed[key], key)
+	}
+	return rows, hidden
+}
+
+func printResults(results []PortResult, scan HostScan, output OutputOptions) {
+	if progress {
+		fmt.Printf("\r%s\r", strings.Repeat(" ", 100))
+	}
+	fmt.Println("\nPortas escaneadas:", scan.Scanned)
+
+	var hidden []string
+	if output.ShowReason && output.Template == nil {
+		results, hidden = reasonRows(results, scan.All)
+	}
 
-	if len(results) > 0 {
+	if len(results) > 0 && output.Template != nil {
+		fmt.Println()
+		for _, r := range results {
+			if err := output.Template.Execute(os.Stdout, r); err != nil {
+				fmt.Println("\nErro ao aplicar template:", err)
+				return
+			}
+			fmt.Println()
+		}
+	} else if len(results) > 0 && output.ShowHost && output.ShowReason {
+		fmt.Println("\nHOST\tPORTA\tESTADO\tSERVIÇO\tMOTIVO")
+		fmt.Println("----\t-----\t------\t-------\t------")
+		for _, r := range results {
+			fmt.Printf("%s\t%d\t%s\t%s\t%s\n", output.Host, r.Port, r.State, r.Service, r.reasonText())
+			printPaths(r)
+		}
+	} else if len(results) > 0 && output.ShowHost {
+		fmt.Println("\nHOST\tPORTA\tESTADO\tSERVIÇO")
+		fmt.Println("----\t-----\t------\t-------")
+		for _, r := range results {
+			fmt.Printf("%s\t%d\t%s\t%s\n", output.Host, r.Port, r.State, r.Service)
+			printPaths(r)
+		}
+	} else if len(results) > 0 && output.ShowReason {
+		fmt.Println("\nPORTA\tESTADO\tSERVIÇO\tMOTIVO")
+		fmt.Println("-----\t------\t-------\t------")
+		for _, r := range results {
+			fmt.Printf("%d\t%s\t%s\t%s\n", r.Port, r.State, r.Service, r.reasonText())
+			printPaths(r)
+		}
+	} else if len(results) > 0 {
 		fmt.Println("\nPORTA\tESTADO\tSERVIÇO")
 		fmt.Println("-----\t------\t-------")
 		for _, r := range results {
 			fmt.Printf("%d\t%s\t%s\n", r.Port, r.State, r.Service)
+			printPaths(r)
 		}
 	} else {
 		fmt.Println("\nNenhuma porta aberta encontrada.")
-		fmt.Println("\nSugestões:")
-		fmt.Println("- Verifique se o host está online e acessível")
-		fmt.Println("- Aumente o timeout (tente -timeout 2000)")
-		fmt.Println("- Escaneie portas específicas conhecidas (-p 80,443,8080,22)")
-		fmt.Println("- O host pode estar protegido por firewall")
+		if !printClosedSample(scan) {
+			fmt.Println("\nSugestões:")
+			fmt.Println("- Verifique se o host está online e acessível")
+			fmt.Println("- Aumente o timeout (tente -timeout 2000)")
+			fmt.Println("- Escaneie portas específicas conhecidas (-p 80,443,8080,22)")
+			fmt.Println("- O host pode estar protegido por firewall")
+		}
+	}
+	for _, line := range hidden {
+		fmt.Println(line)
+	}
+
+	if output.FingerprintUnknown {
+		printUnknownBanners(results)
+	}
+}
+
+// printClosedSample separa as portas que responderam com RST (host ativo,
+// recusando) das que não responderam (possível firewall), com alguns exemplos.
+func printClosedSample(scan HostScan) bool {
+	closed, filtered := scan.Stats.States["closed"], scan.Stats.States["filtered"]
+	if closed == 0 && filtered == 0 {
+		return false
+	}
+	fmt.Println()
+	if closed > 0 {
+		fmt.Printf("Fechadas (RST): %d, ex.: %s\n", closed, formatSample(scan.Samples["closed"]))
+	}
+	if filtered > 0 {
+		fmt.Printf("Filtradas (sem resposta): %d, ex.: %s\n", filtered, formatSample(scan.Samples["filtered"]))
+	}
+	switch {
+	case filtered == 0:
+		fmt.Println("O host está ativo e recusa ativamente as portas testadas; tente outras portas (-p 80,443,8080,22).")
+	case closed == 0:
+		fmt.Println("Nenhuma porta respondeu: o host pode estar offline ou atrás de um firewall; aumente o timeout (tente -timeout 2000).")
+	default:
+		fmt.Println("O host está ativo; as portas sem resposta provavelmente são filtradas por firewall.")
+	}
+	return true
+}
+
+func formatSample(ports []int) string {
+	sorted := append([]int(nil), ports...)
+	sort.Ints(sorted)
+	parts := make([]string, len(sorted))
+	for i, p := range sorted {
+		parts[i] = strconv.Itoa(p)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func printTimings(results []PortResult) {
+	fmt.Println("\nTEMPOS (-timing-debug)")
+	fmt.Println("PORTA\tDIAL\tBANNER\tPROBE")
+	for _, r := range results {
+		if r.Timing == nil {
+			continue
+		}
+		fmt.Printf("%d\t%s\t%s\t%s\n", r.Port, r.Timing.Dial, r.Timing.Banner, r.Timing.Probe)
+	}
+}
+
+func printConfidence(results []PortResult) {
+	fmt.Println("\nCONFIANÇA (-min-open-confidence)")
+	fmt.Println("PORTA\tACEITES")
+	for _, r := range results {
+		if r.State == "open" && r.Confidence != "" {
+			fmt.Printf("%d\t%s\n", r.Port, r.Confidence)
+		}
+	}
+}
+
+func printTCPDetails(results []PortResult) {
+	fmt.Println("\nDETALHES TCP (-tcp-details)")
+	fmt.Println("PORTA\tJANELA\tMSS")
+	for _, r := range results {
+		if r.TCP == nil {
+			continue
+		}
+		fmt.Printf("%d\t%d\t%d\n", r.Port, r.TCP.Window, r.TCP.MSS)
+	}
+}
+
+func printTLSChecks(results []PortResult) {
+	fmt.Println("\nCERTIFICADOS TLS (-verify-tls-hostname)")
+	fmt.Println("PORTA\tNOME\tVÁLIDO\tPROBLEMA")
+	for _, r := range results {
+		if r.TLS == nil {
+			continue
+		}
+		valid, problem := "sim", "-"
+		if !r.TLS.Valid {
+			valid, problem = "não", r.TLS.Problem
+		}
+		fmt.Printf("%d\t%s\t%s\t%s\n", r.Port, r.TLS.Name, valid, problem)
+	}
+}
+
+func printPaths(r PortResult) {
+	for _, p := range r.Paths {
+		fmt.Printf("\t  %s (%d)\n", p.Path, p.Status)
+	}
+}
+
+// guessOS infere o sistema do host a partir dos banners coletados, votando
+// por porta. Retorna o SO mais citado e em quantas portas ele apareceu.
+func guessOS(results []PortResult) (string, int) {
+	votes := make(map[string]int)
+	for _, r := range results {
+		banner := strings.ToLower(r.Banner)
+		for _, k := range osKeywords {
+			if strings.Contains(banner, k.keyword) {
+				votes[k.os]++
+				break
+			}
+		}
+	}
+
+	best, count := "", 0
+	for _, k := range osKeywords {
+		if votes[k.os] > count {
+			best, count = k.os, votes[k.os]
+		}
 	}
+	return best, count
+}
+
+func printUnknownBanners(results []PortResult) {
+	for _, r := range results {
+		if r.State != "open" || r.Banner == "" {
+			continue
+		}
+		if _, known := commonPorts[r.Port]; known {
+			continue
+		}
+
+		dump := r.Banner
+		if len(dump) > bannerDumpSize {
+			dump = dump[:bannerDumpSize]
+		}
 
-	fmt.Printf("\nScan completo em %.2f segundos\n", time.Since(startTime).Seconds())
+		fmt.Printf("\nBanner da porta %d (%d bytes): %s\n", r.Port, len(r.Banner), renderBanner(dump))
+		fmt.Print(hex.Dump([]byte(dump)))
+	}
 }
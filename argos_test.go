@@ -0,0 +1,1638 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func refuseAll(context.Context, string, string) (net.Conn, error) {
+	return nil, syscall.ECONNREFUSED
+}
+
+func TestPacerLimitsRateRegardlessOfThreads(t *testing.T) {
+	const rate, ports = 200, 60
+	for _, threads := range []int{1, 10, 500} {
+		t.Run(fmt.Sprintf("t=%d", threads), func(t *testing.T) {
+			var mu sync.Mutex
+			var starts []time.Time
+			dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+				mu.Lock()
+				starts = append(starts, time.Now())
+				mu.Unlock()
+				return refuseAll(ctx, network, address)
+			}
+
+			list := make([]int, ports)
+			for i := range list {
+				list[i] = i + 1
+			}
+			scanHost(context.Background(), "127.0.0.1", list, ScanOptions{
+				Protocol: "tcp",
+				Threads:  threads,
+				Timeout:  time.Second,
+				Rate:     rate,
+				Dial:     dial,
+			})
+
+			if len(starts) != ports {
+				t.Fatalf("%d conexões, esperado %d", len(starts), ports)
+			}
+			first, last := starts[0], starts[0]
+			for _, s := range starts {
+				if s.Before(first) {
+					first = s
+				}
+				if s.After(last) {
+					last = s
+				}
+			}
+			// n conexões a no máximo rate/s precisam de pelo menos (n-1)/rate.
+			min := time.Duration(ports-1) * time.Second / rate
+			if elapsed := last.Sub(first); elapsed < min-5*time.Millisecond {
+				t.Fatalf("%d conexões em %s, acima de %d/s (mínimo %s)", ports, elapsed, rate, min)
+			}
+		})
+	}
+}
+
+func TestPacerNilIsUnlimited(t *testing.T) {
+	p := newPacer(0)
+	if p != nil {
+		t.Fatalf("newPacer(0) = %v, esperado nil", p)
+	}
+	start := time.Now()
+	for i := 0; i < 1000; i++ {
+		p.Wait()
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Fatalf("pacer nil esperou %s", elapsed)
+	}
+}
+
+func TestIsHostAliveLoopbackRefused(t *testing.T) {
+	port, err := freeLocalPort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isHostAlive("127.0.0.1", []int{port}, time.Second) {
+		t.Fatalf("127.0.0.1 com a porta %d recusando deveria estar online", port)
+	}
+}
+
+func TestScanLoopback(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	open := ln.Addr().(*net.TCPAddr).Port
+	closed, err := freeLocalPort()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	targets := resolveTargets([]string{"localhost"}, ResolveOptions{PreferIPv4: true})
+	if len(targets) != 1 || targets[0].IP != "127.0.0.1" {
+		t.Fatalf("localhost resolveu para %+v", targets)
+	}
+	if addr := targets[0].Address(); addr != "127.0.0.1, IPv4, loopback" {
+		t.Fatalf("Address() = %q", addr)
+	}
+
+	scan := scanHost(context.Background(), targets[0].IP, []int{open, closed}, ScanOptions{Protocol: "tcp", Threads: 2, Timeout: time.Second})
+	if len(scan.Results) != 1 || scan.Results[0].Port != open {
+		t.Fatalf("portas abertas = %+v, esperado só %d", scan.Results, open)
+	}
+	if scan.Stats.States["closed"] != 1 {
+		t.Fatalf("estados = %v, esperado 1 closed", scan.Stats.States)
+	}
+}
+
+func TestSplitZone(t *testing.T) {
+	tests := []struct {
+		host, addr, zone string
+	}{
+		{"fe80::1%eth0", "fe80::1", "eth0"},
+		{"fe80::1%2", "fe80::1", "2"},
+		{"fe80::1", "fe80::1", ""},
+		{"192.168.0.1", "192.168.0.1", ""},
+		{"exemplo%teste.com", "exemplo%teste.com", ""},
+	}
+	for _, tt := range tests {
+		addr, zone := splitZone(tt.host)
+		if addr != tt.addr || zone != tt.zone {
+			t.Errorf("splitZone(%q) = %q, %q; esperado %q, %q", tt.host, addr, zone, tt.addr, tt.zone)
+		}
+	}
+}
+
+func loopbackInterface(t *testing.T) net.Interface {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Skip(err)
+	}
+	for _, ifi := range ifaces {
+		if ifi.Flags&net.FlagLoopback != 0 {
+			return ifi
+		}
+	}
+	t.Skip("nenhuma interface de loopback")
+	return net.Interface{}
+}
+
+func TestResolveTargetsKeepsZone(t *testing.T) {
+	lo := loopbackInterface(t)
+	for _, host := range []string{"fe80::1%" + lo.Name, fmt.Sprintf("fe80::1%%%d", lo.Index)} {
+		targets := resolveTargets([]string{host}, ResolveOptions{})
+		if len(targets) != 1 || targets[0].IP != host || targets[0].Family != "IPv6" {
+			t.Errorf("resolveTargets(%q) = %+v", host, targets)
+		}
+	}
+	if targets := resolveTargets([]string{"fe80::1%interface-inexistente"}, ResolveOptions{}); len(targets) != 0 {
+		t.Errorf("zona inválida deveria ser rejeitada, obtido %+v", targets)
+	}
+}
+
+func TestSCTPSockaddrZone(t *testing.T) {
+	lo := loopbackInterface(t)
+	tests := []struct {
+		host string
+		zone uint32
+	}{
+		{"fe80::1%" + lo.Name, uint32(lo.Index)},
+		{"fe80::1%7", 7},
+		{"fe80::1", 0},
+	}
+	for _, tt := range tests {
+		family, sa, err := sctpSockaddr(tt.host, 80)
+		if err != nil {
+			t.Fatalf("sctpSockaddr(%q): %v", tt.host, err)
+		}
+		addr, ok := sa.(*syscall.SockaddrInet6)
+		if family != syscall.AF_INET6 || !ok {
+			t.Fatalf("sctpSockaddr(%q) = %d, %T", tt.host, family, sa)
+		}
+		if addr.ZoneId != tt.zone || addr.Port != 80 {
+			t.Errorf("sctpSockaddr(%q): zona %d porta %d, esperado zona %d porta 80", tt.host, addr.ZoneId, addr.Port, tt.zone)
+		}
+	}
+}
+
+func TestScanPortWithZone(t *testing.T) {
+	lo := loopbackInterface(t)
+	ln, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 indisponível:", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	result := scanPort(context.Background(), "::1%"+lo.Name, port, ScanOptions{Timeout: time.Second})
+	if result.State != "open" {
+		t.Fatalf("::1%%%s porta %d: %s (%s), esperado open", lo.Name, port, result.State, result.Reason)
+	}
+}
+
+func TestExpandOctetRanges(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []string
+	}{
+		{"192.168.1.1-3", []string{"192.168.1.1", "192.168.1.2", "192.168.1.3"}},
+		{"10.0.1-2.3-4", []string{"10.0.1.3", "10.0.1.4", "10.0.2.3", "10.0.2.4"}},
+		{"10.0.1-3.0/24", []string{"10.0.1.0/24", "10.0.2.0/24", "10.0.3.0/24"}},
+		{"10.0.0.0-0", []string{"10.0.0.0"}},
+		{"10.0.0.255-255", []string{"10.0.0.255"}},
+		{"10.0.0.5", []string{"10.0.0.5"}},
+		{"my-host.example.com", []string{"my-host.example.com"}},
+		{"a-b.c-d.e-f.g-h", []string{"a-b.c-d.e-f.g-h"}},
+	}
+	for _, tt := range tests {
+		got, err := expandOctetRanges(tt.spec)
+		if err != nil {
+			t.Errorf("expandOctetRanges(%q): %v", tt.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("expandOctetRanges(%q) = %v, esperado %v", tt.spec, got, tt.want)
+		}
+	}
+
+	full, err := expandOctetRanges("10.0.0.0-255")
+	if err != nil || len(full) != 256 || full[0] != "10.0.0.0" || full[255] != "10.0.0.255" {
+		t.Errorf("expandOctetRanges(10.0.0.0-255) = %d endereços (%v)", len(full), err)
+	}
+
+	for _, spec := range []string{"10.0.0.9-3", "10.0.0.1-256", "10.0.0-300.1", "0-255.0-255.0-255.0-255"} {
+		if _, err := expandOctetRanges(spec); err == nil {
+			t.Errorf("expandOctetRanges(%q) deveria falhar", spec)
+		}
+	}
+}
+
+func TestExpandTargetsRanges(t *testing.T) {
+	hosts, err := expandTargets("192.168.1.10-12,10.0.1-2.0/30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"192.168.1.10", "192.168.1.11", "192.168.1.12", "10.0.1.1", "10.0.1.2", "10.0.2.1", "10.0.2.2"}
+	if !reflect.DeepEqual(hosts, want) {
+		t.Fatalf("expandTargets = %v, esperado %v", hosts, want)
+	}
+}
+
+func TestNetUnreachNeedsAllEarlyResults(t *testing.T) {
+	flaky := func(ctx context.Context, network, address string) (net.Conn, error) {
+		if address == "127.0.0.1:1" {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: os.NewSyscallError("connect", syscall.ENETUNREACH)}
+		}
+		return refuseAll(ctx, network, address)
+	}
+	ports := []int{1, 2, 3, 4, 5, 6, 7, 8}
+	scan := scanHost(context.Background(), "127.0.0.1", ports, ScanOptions{Protocol: "tcp", Threads: 1, Timeout: time.Second, Dial: flaky})
+	if scan.Status != "scanned" || scan.Scanned != len(ports) {
+		t.Fatalf("um ENETUNREACH isolado: status %q, escaneadas %d", scan.Status, scan.Scanned)
+	}
+
+	down := func(ctx context.Context, network, address string) (net.Conn, error) {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: os.NewSyscallError("connect", syscall.ENETUNREACH)}
+	}
+	scan = scanHost(context.Background(), "127.0.0.1", append(ports, 9, 10, 11, 12), ScanOptions{Protocol: "tcp", Threads: 1, Timeout: time.Second, Dial: down})
+	if scan.Status != "unreachable" || scan.Skipped == 0 {
+		t.Fatalf("rede inacessível: status %q, ignoradas %d", scan.Status, scan.Skipped)
+	}
+}
+
+func TestScanSurvivesPanic(t *testing.T) {
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		if address == "127.0.0.1:13" {
+			panic("falha injetada")
+		}
+		return refuseAll(ctx, network, address)
+	}
+
+	scan := scanHost(context.Background(), "127.0.0.1", []int{1, 13, 20, 21}, ScanOptions{Protocol: "tcp", Threads: 2, Timeout: time.Second, Dial: dial})
+	if scan.Scanned != 4 || scan.Skipped != 0 {
+		t.Fatalf("escaneadas %d, ignoradas %d; esperado 4 e 0", scan.Scanned, scan.Skipped)
+	}
+	if scan.Stats.States["error"] != 1 || scan.Stats.States["closed"] != 3 || scan.Stats.Errors != 1 {
+		t.Fatalf("estados = %v, erros = %d", scan.Stats.States, scan.Stats.Errors)
+	}
+
+	result := scanPortSafe(context.Background(), "127.0.0.1", 13, ScanOptions{Protocol: "tcp", Timeout: time.Second, Dial: dial})
+	if result.State != "error" || result.Reason != "panic" || result.Port != 13 {
+		t.Fatalf("scanPortSafe = %+v", result)
+	}
+}
+
+func TestResolvePTRsUsesCache(t *testing.T) {
+	ptrNames.mu.Lock()
+	ptrNames.names["192.0.2.10"] = "cache.exemplo"
+	ptrNames.names["fe80::10"] = "link.exemplo"
+	ptrNames.mu.Unlock()
+
+	targets := []ScanTarget{{IP: "192.0.2.10"}, {IP: "fe80::10%1"}, {IP: "fe80::10%2"}}
+	// Timeout mínimo: qualquer consulta real falharia e deixaria o PTR vazio.
+	if found := resolvePTRs(targets, 2, time.Nanosecond); found != 3 {
+		t.Fatalf("resolvePTRs = %d, esperado 3 (alvos: %+v)", found, targets)
+	}
+	want := []string{"cache.exemplo", "link.exemplo", "link.exemplo"}
+	for i, target := range targets {
+		if target.PTR != want[i] {
+			t.Errorf("%s: PTR %q, esperado %q", target.IP, target.PTR, want[i])
+		}
+	}
+}
+
+func TestReadTCPDetails(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	if d := readTCPDetails(a); d != nil {
+		t.Fatalf("net.Pipe sem socket retornou %+v", d)
+	}
+
+	if runtime.GOOS != "linux" {
+		t.Skip("TCP_INFO só no Linux")
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			defer conn.Close()
+			time.Sleep(time.Second)
+		}
+	}()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	d := readTCPDetails(conn)
+	if d == nil || d.MSS == 0 || d.Window == 0 {
+		t.Fatalf("readTCPDetails = %+v, esperado janela e MSS", d)
+	}
+}
+
+func TestProgressLine(t *testing.T) {
+	single := progressLine("10.0.0.1", 50, 200, ScanOptions{HostIndex: 1, HostCount: 1})
+	if single != "\rEscaneando... 25.0% concluído" {
+		t.Errorf("host único: %q", single)
+	}
+
+	multi := progressLine("10.0.0.42", 100, 200, ScanOptions{HostIndex: 42, HostCount: 100})
+	want := "\rHosts: 41/100 concluídos (41.5%) | host 42 (10.0.0.42): 50.0% das portas"
+	if multi != want {
+		t.Errorf("vários hosts: %q, esperado %q", multi, want)
+	}
+}
+
+func TestParseConfidence(t *testing.T) {
+	if need, of, err := parseConfidence("2/3"); err != nil || need != 2 || of != 3 {
+		t.Errorf("parseConfidence(2/3) = %d, %d, %v", need, of, err)
+	}
+	for _, spec := range []string{"3", "0/3", "4/3", "1/11", "a/b", "2/"} {
+		if _, _, err := parseConfidence(spec); err == nil {
+			t.Errorf("parseConfidence(%q) deveria falhar", spec)
+		}
+	}
+}
+
+func TestConfidenceVoting(t *testing.T) {
+	// accepts define, tentativa a tentativa, se a porta aceita a conexão.
+	tests := []struct {
+		accepts    []bool
+		need, of   int
+		state      string
+		confidence string
+	}{
+		{[]bool{true, true}, 2, 3, "open", "2/2"},
+		{[]bool{true, false, true}, 2, 3, "open", "2/3"},
+		{[]bool{true, false, false}, 2, 3, "filtered", "1/3"},
+		{[]bool{true, false, false}, 3, 3, "filtered", "1/2"},
+	}
+	for _, tt := range tests {
+		var mu sync.Mutex
+		attempt := 0
+		dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			ok := tt.accepts[attempt]
+			attempt++
+			if !ok {
+				return nil, syscall.ECONNREFUSED
+			}
+			a, b := net.Pipe()
+			b.Close()
+			return a, nil
+		}
+		result := scanPort(context.Background(), "127.0.0.1", 1, ScanOptions{Timeout: time.Second, Dial: dial, ConfirmNeed: tt.need, ConfirmOf: tt.of})
+		if result.State != tt.state || result.Confidence != tt.confidence {
+			t.Errorf("%v com %d/%d: %s %q, esperado %s %q", tt.accepts, tt.need, tt.of, result.State, result.Confidence, tt.state, tt.confidence)
+		}
+	}
+}
+
+func TestResolveTargetsStrictFamily(t *testing.T) {
+	hosts := []string{"127.0.0.1", "::1"}
+	tests := []struct {
+		family string
+		want   []string
+	}{
+		{"", []string{"127.0.0.1", "::1"}},
+		{"IPv4", []string{"127.0.0.1"}},
+		{"IPv6", []string{"::1"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, target := range resolveTargets(hosts, ResolveOptions{PreferIPv4: true, Family: tt.family}) {
+			got = append(got, target.IP)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Family %q: %v, esperado %v", tt.family, got, tt.want)
+		}
+	}
+}
+
+func TestBannerHashChangeIsReported(t *testing.T) {
+	if bannerHash("") != "" {
+		t.Fatal("banner vazio não deveria ter hash")
+	}
+	old, upgraded := bannerHash("SSH-2.0-OpenSSH_8.9\r\n"), bannerHash("SSH-2.0-OpenSSH_9.6\r\n")
+	if len(old) != 16 || old == upgraded {
+		t.Fatalf("hashes %q e %q", old, upgraded)
+	}
+
+	first := []PortResult{{Port: 22, State: "open", BannerHash: old}, {Port: 80, State: "open"}, {Port: 443, State: "closed"}}
+	second := []PortResult{{Port: 22, State: "open", BannerHash: upgraded}, {Port: 80, State: "open"}, {Port: 443, State: "open"}}
+	want := []PortChange{
+		{Port: 22, Before: "open, banner " + old, After: "open, banner " + upgraded},
+		{Port: 443, Before: "closed", After: "open"},
+	}
+	if got := diffScans(first, second); !reflect.DeepEqual(got, want) {
+		t.Fatalf("diffScans = %+v, esperado %+v", got, want)
+	}
+}
+
+func TestSampleTargets(t *testing.T) {
+	targets := make([]ScanTarget, 10)
+	for i := range targets {
+		targets[i] = ScanTarget{IP: fmt.Sprintf("10.0.0.%d", i)}
+	}
+
+	first := sampleTargets(targets, 3, nil)
+	if len(first) != 3 || first[0].IP != "10.0.0.0" || first[2].IP != "10.0.0.2" {
+		t.Fatalf("sem rng: %+v", first)
+	}
+	if all := sampleTargets(targets, 20, nil); len(all) != 10 {
+		t.Fatalf("n maior que a lista: %d alvos", len(all))
+	}
+
+	a := sampleTargets(targets, 4, rand.New(rand.NewSource(7)))
+	b := sampleTargets(targets, 4, rand.New(rand.NewSource(7)))
+	if len(a) != 4 || !reflect.DeepEqual(a, b) {
+		t.Fatalf("mesma semente deu %+v e %+v", a, b)
+	}
+	seen := make(map[string]bool)
+	for i, target := range a {
+		if seen[target.IP] {
+			t.Fatalf("alvo repetido na amostra: %+v", a)
+		}
+		seen[target.IP] = true
+		if i > 0 && a[i-1].IP >= target.IP {
+			t.Fatalf("amostra fora da ordem original: %+v", a)
+		}
+	}
+}
+
+func TestRetryPause(t *testing.T) {
+	auto := ScanOptions{RetryAuto: true, RetryBackoff: 2}
+	if wait := retryPause("192.168.0.10", 1, auto); wait != 0 {
+		t.Errorf("auto em rede privada: %s", wait)
+	}
+	if wait := retryPause("203.0.113.5", 2, auto); wait != 2*autoRetryDelayWAN {
+		t.Errorf("auto fora da rede local, 2ª tentativa: %s", wait)
+	}
+
+	fixed := ScanOptions{RetryDelay: 50 * time.Millisecond, RetryBackoff: 3}
+	for attempt, want := range []time.Duration{50 * time.Millisecond, 150 * time.Millisecond, 450 * time.Millisecond} {
+		if wait := retryPause("127.0.0.1", attempt+1, fixed); wait != want {
+			t.Errorf("tentativa %d: %s, esperado %s", attempt+1, wait, want)
+		}
+	}
+	if wait := retryPause("127.0.0.1", 20, fixed); wait != maxRetryDelay {
+		t.Errorf("backoff sem teto: %s", wait)
+	}
+
+	for _, value := range []string{"-1s", "1m", "rápido"} {
+		if _, _, err := parseRetryDelay(value); err == nil {
+			t.Errorf("parseRetryDelay(%q) deveria falhar", value)
+		}
+	}
+}
+
+func TestScanPortWaitsBetweenRetries(t *testing.T) {
+	var mu sync.Mutex
+	var attempts []time.Time
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		mu.Lock()
+		attempts = append(attempts, time.Now())
+		mu.Unlock()
+		return refuseAll(ctx, network, address)
+	}
+	opts := ScanOptions{Timeout: time.Second, Dial: dial, ResetRetries: 2, RetryDelay: 30 * time.Millisecond, RetryBackoff: 2}
+	result := scanPort(context.Background(), "127.0.0.1", 1, opts)
+	if result.Retries != 2 || len(attempts) != 3 {
+		t.Fatalf("%d novas tentativas em %d conexões", result.Retries, len(attempts))
+	}
+	if gap := attempts[2].Sub(attempts[1]); gap < 60*time.Millisecond {
+		t.Fatalf("segunda pausa de %s, esperado ao menos 60ms", gap)
+	}
+}
+
+func TestRenderBanner(t *testing.T) {
+	banner := "220 Ol\xe1 \xc3\xa9\x1b[0m\r\n"
+	tests := []struct {
+		encoding, want string
+	}{
+		{"safe", `220 Ol\xe1 \xc3\xa9\x1b[0m\r\n`},
+		{"utf8", `220 Ol\xe1 é\x1b[0m\r\n`},
+		{"latin1", `220 Olá Ã©\x1b[0m\r\n`},
+		{"hex", "323230204f6ce120c3a91b5b306d0d0a"},
+	}
+	defer func() { bannerEncoding = "safe" }()
+	for _, tt := range tests {
+		bannerEncoding = tt.encoding
+		if got := renderBanner(banner); got != tt.want {
+			t.Errorf("%s: %q, esperado %q", tt.encoding, got, tt.want)
+		}
+	}
+
+	bannerEncoding = "hex"
+	if got := jsonBanners([]PortResult{{Banner: "A\n"}})[0].Banner; got != "410a" {
+		t.Errorf("JSON em hex: %q", got)
+	}
+	bannerEncoding = "safe"
+	results := []PortResult{{Banner: "\xff"}}
+	if got := jsonBanners(results); got[0].Banner != "\xff" {
+		t.Errorf("JSON em safe deveria manter o banner cru: %q", got[0].Banner)
+	}
+}
+
+func TestOrderByFrequency(t *testing.T) {
+	ports := []int{1, 22, 80, 443, 5000, 8080, 4}
+	orderByFrequency(ports, []int{80, 443, 22, 8080})
+	want := []int{80, 443, 22, 8080, 1, 5000, 4}
+	if !reflect.DeepEqual(ports, want) {
+		t.Fatalf("orderByFrequency = %v, esperado %v", ports, want)
+	}
+
+	ranked, err := topPorts(math.MaxInt, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := make([]int, 1024)
+	for i := range all {
+		all[i] = i + 1
+	}
+	orderByFrequency(all, ranked)
+	if all[0] != builtinTopPorts[0] || len(all) != 1024 {
+		t.Fatalf("primeira porta %d, esperado %d", all[0], builtinTopPorts[0])
+	}
+}
+
+func TestResultsCallbackBatches(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]StreamRecord
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []StreamRecord
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			t.Errorf("corpo inválido: %v", err)
+		}
+		mu.Lock()
+		batches = append(batches, batch)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	callback := newResultsCallback(srv.URL, time.Second)
+	for _, port := range []int{22, 80, 443} {
+		callback.Send("10.0.0.1", PortResult{Port: port, State: "open"})
+	}
+	callback.Close()
+
+	if len(batches) != 1 || len(batches[0]) != 3 {
+		t.Fatalf("lotes recebidos: %+v", batches)
+	}
+	if got := batches[0][2]; got.Host != "10.0.0.1" || got.Port != 443 {
+		t.Fatalf("último registro: %+v", got)
+	}
+}
+
+func TestResultsCallbackFailureIsNotFatal(t *testing.T) {
+	callback := newResultsCallback("http://127.0.0.1:1", time.Second)
+	callback.Send("10.0.0.1", PortResult{Port: 22, State: "open"})
+	callback.Close()
+}
+
+func TestBaselineDiff(t *testing.T) {
+	report := JSONReport{Hosts: []JSONHost{
+		{Host: "10.0.0.1", Results: []PortResult{{Port: 22, State: "open"}, {Port: 80, State: "open"}, {Port: 8080, State: "open"}}},
+		{Host: "10.0.0.2", Results: []PortResult{{Port: 443, State: "open"}, {Port: 25, State: "closed"}}},
+	}}
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := t.TempDir() + "/baseline.json"
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	baseline, err := loadBaseline(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(baseline) != 4 || baseline["10.0.0.2:25"] {
+		t.Fatalf("baseline = %v", baseline)
+	}
+
+	scanned := []int{22, 80, 443, 3306}
+	added, missing := baselineDiff(baseline, "10.0.0.1", scanned, []PortResult{{Port: 22, State: "open"}, {Port: 3306, State: "open"}})
+	// 8080 estava aberta, mas não foi escaneada agora: não conta como ausente.
+	if !reflect.DeepEqual(added, []int{3306}) || !reflect.DeepEqual(missing, []int{80}) {
+		t.Fatalf("novas %v, ausentes %v", added, missing)
+	}
+
+	added, missing = baselineDiff(baseline, "10.0.0.3", scanned, []PortResult{{Port: 22, State: "open"}})
+	if !reflect.DeepEqual(added, []int{22}) || missing != nil {
+		t.Fatalf("host fora do baseline: novas %v, ausentes %v", added, missing)
+	}
+
+	if _, err := loadBaseline(t.TempDir() + "/inexistente.json"); err == nil {
+		t.Fatal("baseline inexistente deveria falhar")
+	}
+}
+
+func TestRescanFiltered(t *testing.T) {
+	report := JSONReport{
+		Hosts: []JSONHost{
+			{Host: "127.0.0.1", Results: []PortResult{{Port: 80, State: "open"}}, Filtered: []int{22, 443, 8080}, Stats: ScanStats{States: map[string]int{"open": 1, "filtered": 3}}},
+			{Host: "127.0.0.2", Results: []PortResult{}},
+		},
+		Stats: ScanStats{States: map[string]int{"open": 1, "filtered": 3}},
+	}
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		switch address {
+		case "127.0.0.1:22":
+			a, b := net.Pipe()
+			b.Close()
+			return a, nil
+		case "127.0.0.1:443":
+			return nil, syscall.ECONNREFUSED
+		}
+		return nil, &net.OpError{Op: "dial", Net: network, Err: os.ErrDeadlineExceeded}
+	}
+	changes := rescanFiltered(context.Background(), &report, ScanOptions{Protocol: "tcp", Threads: 2, Timeout: time.Second, Dial: dial})
+
+	want := []PortChange{{Port: 22, Before: "filtered", After: "open"}, {Port: 443, Before: "filtered", After: "closed"}}
+	if !reflect.DeepEqual(changes["127.0.0.1"], want) || len(changes) != 1 {
+		t.Fatalf("mudanças = %v", changes)
+	}
+	h := report.Hosts[0]
+	if !reflect.DeepEqual(h.Filtered, []int{8080}) {
+		t.Fatalf("filtradas = %v, esperado [8080]", h.Filtered)
+	}
+	if len(h.Results) != 2 || h.Results[0].Port != 22 || h.Results[1].Port != 80 {
+		t.Fatalf("resultados = %+v", h.Results)
+	}
+	states := map[string]int{"open": 2, "closed": 1, "filtered": 1}
+	if !reflect.DeepEqual(h.Stats.States, states) || !reflect.DeepEqual(report.Stats.States, states) {
+		t.Fatalf("estados do host %v, do relatório %v", h.Stats.States, report.Stats.States)
+	}
+}
+
+func TestEstimateScanTime(t *testing.T) {
+	opts := ScanOptions{Threads: 100, Timeout: 500 * time.Millisecond}
+	if got := estimateScanTime(1, 65535, opts); got != 656*500*time.Millisecond {
+		t.Errorf("65535 portas, 100 threads: %s", got)
+	}
+	opts.Retries = 1
+	if got := estimateScanTime(2, 100, opts); got != 2*time.Second {
+		t.Errorf("2 hosts com 1 retry: %s", got)
+	}
+	opts.Rate = 10
+	if got := estimateScanTime(1, 100, opts); got != 20*time.Second {
+		t.Errorf("-rate mais lento que as threads: %s", got)
+	}
+	opts.HostTimeout = 5 * time.Second
+	if got := estimateScanTime(3, 100, opts); got != 15*time.Second {
+		t.Errorf("-host-timeout como teto: %s", got)
+	}
+}
+
+func TestExpandPortShortcut(t *testing.T) {
+	got := expandPortShortcut([]string{"-host", "10.0.0.1", "-p-", "-v"})
+	want := []string{"-host", "10.0.0.1", "-p=1-65535", "-v"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expandPortShortcut = %v, esperado %v", got, want)
+	}
+}
+
+func TestVerifyTLSHostnames(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	plain, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+	go func() {
+		for {
+			conn, err := plain.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("HELLO\r\n"))
+			conn.Close()
+		}
+	}()
+
+	results := []PortResult{
+		{Port: srv.Listener.Addr().(*net.TCPAddr).Port, State: "open"},
+		{Port: plain.Addr().(*net.TCPAddr).Port, State: "open"},
+	}
+	verifyTLSHostnames("127.0.0.1", "127.0.0.1", results, ScanOptions{Threads: 2, Timeout: time.Second})
+	if results[0].TLS == nil || results[0].TLS.Valid || results[0].TLS.Problem != "self-signed" {
+		t.Fatalf("porta TLS: %+v", results[0].TLS)
+	}
+	if results[1].TLS != nil {
+		t.Fatalf("porta sem TLS: %+v", results[1].TLS)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	certs := []*x509.Certificate{srv.Certificate()}
+	if check := checkCertificate(certs, "example.com", roots); !check.Valid || check.Problem != "" {
+		t.Fatalf("example.com: %+v", check)
+	}
+	if check := checkCertificate(certs, "outro.exemplo", roots); check.Valid || check.Problem != "hostname-mismatch" {
+		t.Fatalf("outro.exemplo: %+v", check)
+	}
+}
+
+func TestReadHost(t *testing.T) {
+	in := bufio.NewReader(strings.NewReader("  example.com \n\nhost um\n10.0.0.0/33\n192.168.0.1, 192.168.0.2\r\n::1"))
+	want := []struct {
+		host string
+		ok   bool
+	}{
+		{"example.com", true},
+		{"", false},
+		{"", false},
+		{"", false},
+		{"192.168.0.1, 192.168.0.2", true},
+		{"::1", true},
+	}
+	for i, w := range want {
+		host, err := readHost(in)
+		if host != w.host || (err == nil) != w.ok || err == io.EOF {
+			t.Fatalf("linha %d: %q, %v; esperado %q", i+1, host, err, w.host)
+		}
+	}
+	if _, err := readHost(in); err != io.EOF {
+		t.Fatalf("entrada encerrada: %v, esperado io.EOF", err)
+	}
+}
+
+func TestJSONSchemaMatchesPortResult(t *testing.T) {
+	full := PortResult{
+		Port: 443, State: "open", Service: "HTTPS", Banner: "b", BannerHash: "h", Reason: "syn-ack",
+		Retries: 1, Confidence: "2/3", Paths: []HTTPPath{{Path: "/", Status: 200}}, Latency: time.Millisecond,
+		Timing: &PortTiming{}, TCP: &TCPDetails{}, TLS: &TLSCheck{Name: "example.com"},
+	}
+	schema := jsonSchema(reflect.TypeOf(PortResult{}))
+	properties := schema["properties"].(map[string]any)
+
+	var fields map[string]any
+	data, _ := json.Marshal(full)
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if len(fields) != len(properties) {
+		t.Fatalf("JSON com %d campos, schema com %d", len(fields), len(properties))
+	}
+	for name := range fields {
+		if properties[name] == nil {
+			t.Errorf("campo %s ausente do schema", name)
+		}
+	}
+
+	// Os obrigatórios são exatamente os que o valor zero ainda grava.
+	data, _ = json.Marshal(PortResult{})
+	fields = nil
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	required := schema["required"].([]string)
+	if len(required) != len(fields) {
+		t.Fatalf("obrigatórios %v, valor zero grava %v", required, fields)
+	}
+	for _, name := range required {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("%s é obrigatório, mas some do JSON do valor zero", name)
+		}
+	}
+}
+
+func TestFormatMatrix(t *testing.T) {
+	scans := []HostScan{
+		{IP: "10.0.0.1", All: []PortResult{{Port: 22, State: "open"}, {Port: 80, State: "closed"}}},
+		{IP: "10.0.0.2", All: []PortResult{{Port: 80, State: "filtered"}, {Port: 22, State: "open"}}},
+		{IP: "10.0.0.3", All: []PortResult{{Port: 22, State: "closed"}}, Status: "unreachable"},
+	}
+	want := []string{
+		"HOST\t22\t80",
+		"10.0.0.1\topen\tclosed",
+		"10.0.0.2\topen\tfiltered",
+		"10.0.0.3\tclosed\t-",
+		"ABERTAS\t2/3\t0/3",
+	}
+	if got := formatMatrix(scans, []int{80, 22}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("formatMatrix =\n%s\nesperado\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestTwoPhaseBannersReachTarpitCheck(t *testing.T) {
+	var all, results []PortResult
+	for port := 1; port <= tarpitMinPorts; port++ {
+		all = append(all, PortResult{Port: port, State: "open", Latency: time.Millisecond})
+		results = append(results, PortResult{Port: port, State: "open", Latency: time.Millisecond, Banner: fmt.Sprintf("serviço %d", port)})
+	}
+	all = append(all, PortResult{Port: 9999, State: "closed"})
+
+	if !detectTarpit(all) {
+		t.Fatal("sem banners, as portas abertas deveriam parecer idênticas")
+	}
+	mergeOpenResults(all, results)
+	if all[0].Banner != "serviço 1" || all[len(all)-1].State != "closed" {
+		t.Fatalf("mergeOpenResults = %+v ... %+v", all[0], all[len(all)-1])
+	}
+	if detectTarpit(all) {
+		t.Fatal("banners distintos da segunda fase não deveriam indicar tarpit")
+	}
+}
+
+func TestConfigFileLaterKeyWins(t *testing.T) {
+	defer func(saved *flag.FlagSet) { flag.CommandLine = saved }(flag.CommandLine)
+	flag.CommandLine = flag.NewFlagSet("argos", flag.ContinueOnError)
+	ports := flag.String("p", "1-1024", "")
+	threads := flag.Int("t", defaultThreads, "")
+
+	path := filepath.Join(t.TempDir(), "argos.conf")
+	conf := "# padrões do time\n[scan]\nports = 22\np = 80,443\nt = 50\nthreads = \"20\"\n"
+	if err := os.WriteFile(path, []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfigFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if *ports != "80,443" || *threads != 20 {
+		t.Fatalf("-p %q, -t %d; esperado a última linha de cada opção", *ports, *threads)
+	}
+
+	if err := flag.CommandLine.Parse([]string{"-t", "5"}); err != nil {
+		t.Fatal(err)
+	}
+	if *ports != "80,443" || *threads != 5 {
+		t.Fatalf("-p %q, -t %d; a linha de comando deveria vencer o arquivo", *ports, *threads)
+	}
+
+	if err := os.WriteFile(path, []byte("portas = 22\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfigFile(path); err == nil || !strings.Contains(err.Error(), "portas") {
+		t.Fatalf("opção desconhecida: erro %v", err)
+	}
+}
+
+func TestPortRangeAcceptsServiceNames(t *testing.T) {
+	ports, err := parsePortRange("ssh, 80,8000-8002,HTTPS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{22, 80, 8000, 8001, 8002, 443}; !reflect.DeepEqual(ports, want) {
+		t.Fatalf("parsePortRange = %v, esperado %v", ports, want)
+	}
+	if _, err := parsePortRange("22,gopher"); err == nil || !strings.Contains(err.Error(), "serviço desconhecido: gopher") {
+		t.Fatalf("serviço desconhecido: erro %v", err)
+	}
+}
+
+func TestDialReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, "syn-ack"},
+		{os.ErrDeadlineExceeded, "no-response"},
+		{&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, "conn-refused"},
+		{&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.EHOSTUNREACH)}, "host-unreach"},
+		{errProxyAuth, "proxy-auth"},
+		{io.ErrUnexpectedEOF, "error"},
+	}
+	for _, tt := range tests {
+		if got := dialReason(tt.err); got != tt.want {
+			t.Errorf("dialReason(%v) = %q, esperado %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestPostScanHooksRunInOrder(t *testing.T) {
+	defer func(saved []postScanHook, id string) { postScanHooks, runID = saved, id }(postScanHooks, runID)
+	postScanHooks, runID = nil, "run-teste"
+
+	path := filepath.Join(t.TempDir(), "resultados.txt")
+	var hosts []string
+	registerPostScanHook(fileWriterHook(path))
+	registerPostScanHook(func(host string, results []PortResult) {
+		hosts = append(hosts, fmt.Sprintf("%s:%d", host, len(results)))
+	})
+	runPostScanHooks("10.0.0.1", []PortResult{{Port: 22, State: "open", Service: "SSH"}})
+	runPostScanHooks("10.0.0.2", nil)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# 10.0.0.1 (run run-teste)\n22\topen\tSSH\n# 10.0.0.2 (run run-teste)\n"
+	if string(data) != want {
+		t.Fatalf("arquivo -o:\n%s\nesperado:\n%s", data, want)
+	}
+	if !reflect.DeepEqual(hosts, []string{"10.0.0.1:1", "10.0.0.2:0"}) {
+		t.Fatalf("hook registrado viu %v", hosts)
+	}
+}
+
+func TestTemporaryDNSError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&net.DNSError{Err: "server misbehaving", IsTemporary: true}, true},
+		{&net.DNSError{Err: "i/o timeout", IsTimeout: true}, true},
+		{&net.DNSError{Err: "no such host", IsNotFound: true, IsTemporary: true}, false},
+		{fmt.Errorf("lookup: %w", &net.DNSError{Err: "i/o timeout", IsTimeout: true}), true},
+		{syscall.ECONNREFUSED, false},
+	}
+	for _, tt := range tests {
+		if got := isTemporaryDNSError(tt.err); got != tt.want {
+			t.Errorf("isTemporaryDNSError(%v) = %v, esperado %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestCompareExpected(t *testing.T) {
+	results := []PortResult{{Port: 22, State: "open"}, {Port: 80, State: "open"}, {Port: 3306, State: "open"}, {Port: 443, State: "closed"}}
+	unexpected, missing := compareExpected(results, []int{22, 80, 443})
+	if !reflect.DeepEqual(unexpected, []int{3306}) || !reflect.DeepEqual(missing, []int{443}) {
+		t.Fatalf("inesperadas %v, ausentes %v", unexpected, missing)
+	}
+	if unexpected, missing := compareExpected(results[:2], []int{22, 80}); unexpected != nil || missing != nil {
+		t.Fatalf("sem desvio: inesperadas %v, ausentes %v", unexpected, missing)
+	}
+}
+
+func TestEnvDefaults(t *testing.T) {
+	defer func(saved *flag.FlagSet) { flag.CommandLine = saved }(flag.CommandLine)
+	flag.CommandLine = flag.NewFlagSet("argos", flag.ContinueOnError)
+	ports := flag.String("p", "1-1024", "")
+	top := flag.Int("top-ports", 0, "")
+	flag.String("config", "", "")
+
+	// O -config já foi aplicado quando o ambiente é lido.
+	if err := flag.Set("p", "80"); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ARGOS_PORTS", "22")
+	t.Setenv("ARGOS_TOP_PORTS", "10")
+	t.Setenv("ARGOS_CONFIG", "ignorado.conf")
+	if err := applyEnvDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	if *ports != "22" || *top != 10 || flag.Lookup("config").Value.String() != "" {
+		t.Fatalf("-p %q, -top-ports %d, -config %q", *ports, *top, flag.Lookup("config").Value)
+	}
+
+	t.Setenv("ARGOS_P", "22")
+	if err := applyEnvDefaults(); err != nil {
+		t.Fatalf("apelido com o mesmo valor: %v", err)
+	}
+	t.Setenv("ARGOS_P", "443")
+	if err := applyEnvDefaults(); err == nil || !strings.Contains(err.Error(), "ARGOS_P e ARGOS_PORTS") {
+		t.Fatalf("apelidos em conflito: erro %v", err)
+	}
+}
+
+func TestSortResults(t *testing.T) {
+	results := []PortResult{
+		{Port: 443, State: "open", Service: "HTTPS", Latency: 2 * time.Millisecond},
+		{Port: 22, State: "open", Service: "SSH", Latency: 9 * time.Millisecond},
+		{Port: 80, State: "filtered", Service: "HTTP", Latency: 2 * time.Millisecond},
+	}
+	tests := []struct {
+		by   string
+		want []int
+	}{
+		{"port", []int{22, 80, 443}},
+		{"latency", []int{22, 80, 443}},
+		{"service", []int{80, 443, 22}},
+		{"state", []int{80, 22, 443}},
+	}
+	for _, tt := range tests {
+		sortResults(results, tt.by)
+		var got []int
+		for _, r := range results {
+			got = append(got, r.Port)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("-sort %s: %v, esperado %v", tt.by, got, tt.want)
+		}
+	}
+}
+
+func TestScanHostTimeout(t *testing.T) {
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	ports := make([]int, 20)
+	for i := range ports {
+		ports[i] = i + 1
+	}
+
+	start := time.Now()
+	scan := scanHost(context.Background(), "127.0.0.1", ports, ScanOptions{Protocol: "tcp", Threads: 2, Timeout: 10 * time.Second, HostTimeout: 50 * time.Millisecond, Dial: dial})
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("host levou %s com -host-timeout 50ms", elapsed)
+	}
+	if scan.Skipped == 0 || scan.Stats.States["skipped"] != scan.Skipped || scan.Stats.Total != len(ports) {
+		t.Fatalf("ignoradas %d, estados %v, total %d", scan.Skipped, scan.Stats.States, scan.Stats.Total)
+	}
+}
+
+func TestScanStatsMerge(t *testing.T) {
+	host := newScanStats()
+	for _, r := range []PortResult{
+		{Port: 22, State: "open"},
+		{Port: 80, State: "open", Retries: 1},
+		{Port: 81, State: "filtered", Retries: 2},
+		{Port: 82, State: "error", Reason: "panic"},
+		{Port: 83, State: "skipped"},
+	} {
+		host.record(r)
+	}
+	if host.Total != 5 || host.Rescued != 1 || host.Retried != 1 || host.Errors != 1 {
+		t.Fatalf("estatísticas do host = %+v", host)
+	}
+
+	overall := newScanStats()
+	overall.merge(host)
+	overall.merge(host)
+	overall.finish(2 * time.Second)
+	if overall.Total != 10 || overall.States["open"] != 4 || overall.Rate != 4 {
+		t.Fatalf("estatísticas gerais = %+v", overall)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	unlimited := newRetryBudget(0)
+	for i := 0; i < 100; i++ {
+		if !unlimited.take() {
+			t.Fatal("sem -retry-budget toda nova tentativa deveria ser permitida")
+		}
+	}
+
+	budget := newRetryBudget(3)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	granted := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if budget.take() {
+				mu.Lock()
+				granted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if granted != 3 {
+		t.Fatalf("%d novas tentativas concedidas, esperado 3", granted)
+	}
+}
+
+func TestWorkerPoolBoundsConcurrency(t *testing.T) {
+	const threads, total = 4, 200
+	var mu sync.Mutex
+	inflight, peak := 0, 0
+	dialed := make(map[string]int)
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		mu.Lock()
+		inflight++
+		peak = max(peak, inflight)
+		dialed[address]++
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		inflight--
+		mu.Unlock()
+		return refuseAll(ctx, network, address)
+	}
+	ports := make([]int, total)
+	for i := range ports {
+		ports[i] = i + 1
+	}
+
+	before := runtime.NumGoroutine()
+	scan := scanHost(context.Background(), "127.0.0.1", ports, ScanOptions{Protocol: "tcp", Threads: threads, Timeout: time.Second, Dial: dial})
+	if scan.Scanned != total || len(dialed) != total {
+		t.Fatalf("escaneadas %d, endereços discados %d; esperado %d", scan.Scanned, len(dialed), total)
+	}
+	for address, n := range dialed {
+		if n != 1 {
+			t.Fatalf("%s discado %d vezes", address, n)
+		}
+	}
+	if peak > threads {
+		t.Fatalf("%d conexões simultâneas com -t %d", peak, threads)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if after := runtime.NumGoroutine(); after > before+1 {
+		t.Fatalf("%d goroutines antes do scan, %d depois", before, after)
+	}
+}
+
+func TestRollupServices(t *testing.T) {
+	scans := []HostScan{
+		{IP: "10.0.0.1", Results: []PortResult{{Port: 22, State: "open", Service: "SSH"}, {Port: 80, State: "open", Service: "HTTP"}, {Port: 8081, State: "open", Service: "HTTP"}}},
+		{IP: "10.0.0.2", Results: []PortResult{{Port: 22, State: "open", Service: "SSH"}, {Port: 3306, State: "open", Service: "MySQL"}}},
+		{IP: "10.0.0.3", Results: []PortResult{{Port: 22, State: "open", Service: "SSH"}}},
+	}
+	want := []ServiceCount{{Service: "SSH", Hosts: 3}, {Service: "HTTP", Hosts: 1}, {Service: "MySQL", Hosts: 1}}
+	if got := rollupServices(scans); !reflect.DeepEqual(got, want) {
+		t.Fatalf("rollupServices = %+v, esperado %+v", got, want)
+	}
+}
+
+func TestOutputDirHook(t *testing.T) {
+	defer func(id string) { runID = id }(runID)
+	runID = "run-teste"
+	dir := t.TempDir()
+	results := []PortResult{{Port: 22, State: "open", Service: "SSH", Banner: "SSH-2.0-OpenSSH_9.6"}}
+
+	outputDirHook(dir, "json")("fe80::1%eth0", results)
+	data, err := os.ReadFile(filepath.Join(dir, "fe80__1%eth0.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got HostResults
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.RunID != "run-teste" || got.Host != "fe80::1%eth0" || len(got.Results) != 1 || got.Results[0].Banner != "SSH-2.0-OpenSSH_9.6" {
+		t.Fatalf("arquivo JSON = %+v", got)
+	}
+
+	outputDirHook(dir, "txt")("10.0.0.1", results)
+	data, err = os.ReadFile(filepath.Join(dir, "10.0.0.1.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "# 10.0.0.1 (run run-teste)\n22\topen\tSSH\n"; string(data) != want {
+		t.Fatalf("arquivo texto = %q, esperado %q", data, want)
+	}
+}
+
+func TestProbeHTTPPaths(t *testing.T) {
+	var mu sync.Mutex
+	var methods []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		methods = append(methods, r.Method)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/admin":
+			w.WriteHeader(http.StatusForbidden)
+		case "/old":
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+		case "/health":
+			w.WriteHeader(http.StatusOK)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	addr := srv.Listener.Addr().(*net.TCPAddr)
+
+	opts := ScanOptions{Threads: 2, Timeout: time.Second}
+	client := newHostHTTPClient(opts)
+	defer client.CloseIdleConnections()
+	r := PortResult{Port: addr.Port, State: "open", Service: "HTTP"}
+	got := probeHTTPPaths(client, "127.0.0.1", r, []string{"/admin", "/missing", "/old", "/health"}, opts)
+	want := []HTTPPath{{Path: "/admin", Status: 403}, {Path: "/old", Status: 301}, {Path: "/health", Status: 200}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("probeHTTPPaths = %+v, esperado %+v", got, want)
+	}
+	for _, m := range methods {
+		if m != http.MethodHead {
+			t.Fatalf("requisição %s, esperado apenas HEAD", m)
+		}
+	}
+}
+
+func TestFilterServices(t *testing.T) {
+	results := []PortResult{{Port: 22, Service: "SSH"}, {Port: 80, Service: "HTTP"}, {Port: 3306, Service: "MySQL"}}
+	if got := filterServices(results, parseServiceFilter("")); len(got) != 3 {
+		t.Fatalf("sem -only-services: %+v", got)
+	}
+	got := filterServices(results, parseServiceFilter(" ssh, mysql ,"))
+	if len(got) != 2 || got[0].Port != 22 || got[1].Port != 3306 {
+		t.Fatalf("-only-services ssh,mysql: %+v", got)
+	}
+}
+
+func TestTimeoutAcceptsDurations(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"500", 500 * time.Millisecond},
+		{"2s", 2 * time.Second},
+		{"1m30s", 90 * time.Second},
+		{"250ms", 250 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		var d millisDuration
+		if err := d.Set(tt.value); err != nil || time.Duration(d) != tt.want {
+			t.Errorf("-timeout %s = %s (%v), esperado %s", tt.value, time.Duration(d), err, tt.want)
+		}
+	}
+	var d millisDuration
+	if err := d.Set("rápido"); err == nil {
+		t.Fatal("-timeout rápido deveria falhar")
+	}
+}
+
+func TestFormatPortsOnlyAndCount(t *testing.T) {
+	results := []PortResult{{Port: 22, State: "open"}, {Port: 80, State: "filtered"}, {Port: 443, State: "open"}}
+	if got := formatPortsOnly("10.0.0.1", results); got != "10.0.0.1: 22,443" {
+		t.Fatalf("formatPortsOnly = %q", got)
+	}
+	if got := formatCount("10.0.0.1", results, false); got != "2" {
+		t.Fatalf("formatCount de um host = %q", got)
+	}
+	if got := formatCount("10.0.0.1", results, true); got != "10.0.0.1: 2" {
+		t.Fatalf("formatCount de vários hosts = %q", got)
+	}
+}
+
+func TestThreadGateAdjust(t *testing.T) {
+	g := newThreadGate(8)
+	g.adjust(100, 50, 64)
+	if g.Limit() != 4 {
+		t.Fatalf("com 50%% de timeouts, limite %d; esperado 4", g.Limit())
+	}
+	g.adjust(100, 0, 64)
+	if g.Limit() != 7 {
+		t.Fatalf("sem timeouts, limite %d; esperado 7", g.Limit())
+	}
+	g.adjust(100, 0, 8)
+	if g.Limit() != 8 {
+		t.Fatalf("limite %d acima do teto -t 8", g.Limit())
+	}
+	g.adjust(0, 0, 64)
+	if g.Limit() != 8 {
+		t.Fatalf("janela vazia mudou o limite para %d", g.Limit())
+	}
+
+	released := make(chan bool)
+	g.SetLimit(1)
+	go func() {
+		g.Wait(3)
+		released <- true
+	}()
+	select {
+	case <-released:
+		t.Fatal("worker 3 passou com limite 1")
+	case <-time.After(20 * time.Millisecond):
+	}
+	g.SetLimit(4)
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		t.Fatal("worker 3 não foi liberado com limite 4")
+	}
+}
+
+func TestFailFastStopsAtFirstOpen(t *testing.T) {
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		if address != "127.0.0.1:3" {
+			return refuseAll(ctx, network, address)
+		}
+		a, b := net.Pipe()
+		b.Close()
+		return a, nil
+	}
+	ports := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	scan := scanHost(context.Background(), "127.0.0.1", ports, ScanOptions{Protocol: "tcp", Threads: 1, Timeout: time.Second, FailFast: true, Dial: dial})
+	if len(scan.Results) != 1 || scan.Results[0].Port != 3 || scan.Skipped == 0 {
+		t.Fatalf("abertas %+v, ignoradas %d", scan.Results, scan.Skipped)
+	}
+}
+
+func TestServiceHint(t *testing.T) {
+	if got := serviceHint("+OK ready\r\n"); got != "protocolo texto, 11 bytes" {
+		t.Fatalf("banner texto: %q", got)
+	}
+	if got := serviceHint("\x16\x03\x01\x00"); got != "protocolo binário (0x16), 4 bytes" {
+		t.Fatalf("banner binário: %q", got)
+	}
+}
+
+func TestGuessOS(t *testing.T) {
+	results := []PortResult{
+		{Port: 22, Banner: "SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.6"},
+		{Port: 80, Banner: "HTTP/1.1 200 OK\r\nServer: Apache/2.4.52 (Ubuntu)"},
+		{Port: 25, Banner: "220 mail ESMTP Postfix (Debian/GNU)"},
+		{Port: 21, Banner: "220 FTP pronto"},
+	}
+	if name, votes := guessOS(results); name != "Ubuntu" || votes != 2 {
+		t.Fatalf("guessOS = %s com %d votos, esperado Ubuntu com 2", name, votes)
+	}
+	if name, votes := guessOS(results[3:]); name != "" || votes != 0 {
+		t.Fatalf("sem pistas: guessOS = %q, %d", name, votes)
+	}
+}
+
+func TestExcludeTargets(t *testing.T) {
+	excluded, err := parseExclusions("10.0.0.5, 10.0.1.0/24,fe80::1%eth0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets := []ScanTarget{{IP: "10.0.0.4"}, {IP: "10.0.0.5"}, {IP: "10.0.1.77"}, {IP: "10.0.2.1"}, {IP: "fe80::1%eth1"}}
+	kept, removed := excludeTargets(targets, excluded)
+	var got []string
+	for _, target := range kept {
+		got = append(got, target.IP)
+	}
+	if removed != 3 || !reflect.DeepEqual(got, []string{"10.0.0.4", "10.0.2.1"}) {
+		t.Fatalf("%d removidos, restaram %v", removed, got)
+	}
+	if _, err := parseExclusions("10.0.0.300"); err == nil {
+		t.Fatal("endereço inválido deveria falhar")
+	}
+}
+
+func TestFormatGreppable(t *testing.T) {
+	defer func(id string) { runID = id }(runID)
+	runID = "run-teste"
+	lines := formatGreppable("10.0.0.1", "tcp", []PortResult{{Port: 22, State: "open", Service: "SSH", Reason: "syn-ack"}})
+	want := "Host: 10.0.0.1\tPort: 22/tcp\tState: open\tService: SSH\tReason: syn-ack\tRunID: run-teste"
+	if len(lines) != 1 || lines[0] != want {
+		t.Fatalf("formatGreppable = %q", lines)
+	}
+}
+
+func TestMaxOpenMarksTarpit(t *testing.T) {
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		a, b := net.Pipe()
+		b.Close()
+		return a, nil
+	}
+	ports := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	scan := scanHost(context.Background(), "127.0.0.1", ports, ScanOptions{Protocol: "tcp", Threads: 1, Timeout: time.Second, MaxOpen: 3, Dial: dial})
+	// A porta que já estava em andamento ao atingir o limite ainda entra.
+	if scan.Status != "tarpit" || len(scan.Results) < 3 || scan.Skipped == 0 {
+		t.Fatalf("status %q, %d abertas, %d ignoradas", scan.Status, len(scan.Results), scan.Skipped)
+	}
+}
+
+func TestNewRunID(t *testing.T) {
+	id := newRunID()
+	stamp, suffix, ok := strings.Cut(id, "-")
+	if !ok || len(suffix) != 8 {
+		t.Fatalf("runID %q fora do formato data-hex", id)
+	}
+	if _, err := time.Parse("20060102T150405", stamp); err != nil {
+		t.Fatalf("runID %q: %v", id, err)
+	}
+	if other := newRunID(); other == id {
+		t.Fatalf("dois runIDs iguais: %q", id)
+	}
+}
+
+func TestAssertExitCodes(t *testing.T) {
+	if args, ok := os.LookupEnv("ARGOS_TEST_MAIN_ARGS"); ok {
+		os.Args = append([]string{"argos"}, strings.Fields(args)...)
+		flag.CommandLine = flag.NewFlagSet("argos", flag.ExitOnError)
+		main()
+		os.Exit(0)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	open := ln.Addr().(*net.TCPAddr).Port
+	closed, err := freeLocalPort()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args   string
+		code   int
+		status string
+	}{
+		{fmt.Sprintf("-assert-open %d", open), 0, "ARGOS OK"},
+		{fmt.Sprintf("-assert-open %d,%d", open, closed), exitCritical, "ARGOS CRITICAL"},
+		{fmt.Sprintf("-assert-closed %d", open), exitCritical, "ARGOS CRITICAL"},
+		{fmt.Sprintf("-assert-open %d -assert-closed %d", open, closed), 0, "ARGOS OK"},
+	}
+	for _, tt := range tests {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestAssertExitCodes$")
+		cmd.Env = append(os.Environ(), "ARGOS_TEST_MAIN_ARGS=-host 127.0.0.1 -no-progress "+tt.args)
+		out, err := cmd.Output()
+		code := 0
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			code = exitErr.ExitCode()
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		if code != tt.code || len(lines) != 1 || !strings.HasPrefix(lines[0], tt.status) {
+			t.Errorf("%s: código %d, saída %q; esperado %d e uma linha %s", tt.args, code, out, tt.code, tt.status)
+		}
+	}
+}
+
+func TestParseTargetPairs(t *testing.T) {
+	pairs, err := parseTargetPairs("host1:22, [::1]:443,10.0.0.1:https,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []TargetPair{{Host: "host1", Port: 22}, {Host: "::1", Port: 443}, {Host: "10.0.0.1", Port: 443}}
+	if !reflect.DeepEqual(pairs, want) {
+		t.Fatalf("parseTargetPairs = %+v, esperado %+v", pairs, want)
+	}
+	for _, bad := range []string{"host1", "host1:70000", "host1:gopher", " , "} {
+		if _, err := parseTargetPairs(bad); err == nil {
+			t.Errorf("parseTargetPairs(%q) deveria falhar", bad)
+		}
+	}
+}
+
+func TestNoDNSAcceptsOnlyLiterals(t *testing.T) {
+	defer func(saved bool) { noDNS = saved }(noDNS)
+	noDNS = true
+	ips, err := lookupIP("fe80::1%eth0")
+	if err != nil || len(ips) != 1 || ips[0].String() != "fe80::1" {
+		t.Fatalf("lookupIP(fe80::1%%eth0) = %v, %v", ips, err)
+	}
+	if _, err := lookupIP("localhost"); err == nil || !strings.Contains(err.Error(), "-no-dns") {
+		t.Fatalf("lookupIP(localhost) com -no-dns: erro %v", err)
+	}
+}
+
+func TestHTTPProxyDialer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	var mu sync.Mutex
+	var auths []string
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				req, err := http.ReadRequest(bufio.NewReader(conn))
+				if err != nil {
+					return
+				}
+				mu.Lock()
+				auths = append(auths, req.Header.Get("Proxy-Authorization"))
+				mu.Unlock()
+				switch req.Host {
+				case "10.0.0.1:22":
+					io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\nSSH-2.0-OpenSSH_9.6\r\n")
+				case "10.0.0.1:23":
+					io.WriteString(conn, "HTTP/1.1 504 Gateway Timeout\r\nContent-Length: 0\r\n\r\n")
+				case "10.0.0.1:24":
+					io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\nContent-Length: 0\r\n\r\n")
+				default:
+					io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\nContent-Length: 0\r\n\r\n")
+				}
+			}()
+		}
+	}()
+
+	dial := httpProxyDialer(ln.Addr().String(), "user:pass", time.Second)
+	conn, err := dial(context.Background(), "tcp", "10.0.0.1:22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	banner, err := bufio.NewReader(conn).ReadString('\n')
+	conn.Close()
+	if err != nil || banner != "SSH-2.0-OpenSSH_9.6\r\n" {
+		t.Fatalf("banner pelo túnel = %q, %v", banner, err)
+	}
+
+	for address, want := range map[string]string{"10.0.0.1:23": "no-response", "10.0.0.1:24": "proxy-auth", "10.0.0.1:25": "conn-refused"} {
+		if _, err := dial(context.Background(), "tcp", address); dialReason(err) != want {
+			t.Errorf("%s: %v (%s), esperado %s", address, err, dialReason(err), want)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, auth := range auths {
+		if auth != "Basic dXNlcjpwYXNz" {
+			t.Fatalf("Proxy-Authorization = %q", auth)
+		}
+	}
+}
+
+func TestFormatSample(t *testing.T) {
+	ports := []int{443, 22, 8080}
+	if got := formatSample(ports); got != "22, 443, 8080" {
+		t.Fatalf("formatSample = %q", got)
+	}
+	if ports[0] != 443 {
+		t.Fatalf("formatSample reordenou a amostra original: %v", ports)
+	}
+}
+
+func TestParseProbeOrder(t *testing.T) {
+	order, err := parseProbeOrder(" HTTP,read ,")
+	if err != nil || !reflect.DeepEqual(order, []string{"http", "read"}) {
+		t.Fatalf("parseProbeOrder = %v, %v", order, err)
+	}
+	for _, bad := range []string{"", "http,gopher"} {
+		if _, err := parseProbeOrder(bad); err == nil {
+			t.Errorf("parseProbeOrder(%q) deveria falhar", bad)
+		}
+	}
+}
+
+func TestLooksBlackholed(t *testing.T) {
+	tests := []struct {
+		states map[string]int
+		want   bool
+	}{
+		{map[string]int{"filtered": 1000}, true},
+		{map[string]int{"filtered": 990, "skipped": 10}, true},
+		{map[string]int{"filtered": 999, "closed": 1}, false},
+		{map[string]int{"filtered": 900, "error": 100}, false},
+		{map[string]int{"skipped": 1000}, false},
+	}
+	for _, tt := range tests {
+		stats := ScanStats{States: tt.states}
+		for _, n := range tt.states {
+			stats.Total += n
+		}
+		if got := looksBlackholed(stats); got != tt.want {
+			t.Errorf("looksBlackholed(%v) = %v, esperado %v", tt.states, got, tt.want)
+		}
+	}
+}
+
+func TestPrioritizeOSPorts(t *testing.T) {
+	ports := []int{21, 80, 445, 22, 3389, 8080, 3306}
+	prioritizeOSPorts(ports, "Windows")
+	if want := []int{445, 3389, 21, 80, 22, 8080, 3306}; !reflect.DeepEqual(ports, want) {
+		t.Fatalf("Windows: %v, esperado %v", ports, want)
+	}
+	prioritizeOSPorts(ports, "Debian")
+	if want := []int{22, 3306, 445, 3389, 21, 80, 8080}; !reflect.DeepEqual(ports, want) {
+		t.Fatalf("Debian: %v, esperado %v", ports, want)
+	}
+}
@@ -0,0 +1,10 @@
+module github.com/pdro-h/Argos
+
+go 1.26.0
+
+require (
+	golang.org/x/crypto v0.57.0
+	golang.org/x/term v0.46.0
+)
+
+require golang.org/x/sys v0.48.0
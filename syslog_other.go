@@ -0,0 +1,14 @@
+//go:build windows || plan9
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// newSyslogHook não tem implementação onde log/syslog não existe; o scan
+// segue sem o hook.
+func newSyslogHook(addr, protocol string) (postScanHook, func() error, error) {
+	return nil, nil, fmt.Errorf("syslog não suportado em %s", runtime.GOOS)
+}
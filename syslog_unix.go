@@ -0,0 +1,50 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"fmt"
+	"log/syslog"
+	"net"
+	"os"
+	"strings"
+)
+
+// newSyslogHook conecta ao syslog local ou, com addr, a um servidor remoto
+// no formato [rede://]host:porta (UDP por padrão) e devolve o hook que envia
+// uma mensagem NOTICE por porta aberta, em pares chave=valor para o SIEM.
+func newSyslogHook(addr, protocol string) (postScanHook, func() error, error) {
+	w, err := newSyslogWriter(addr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var failed bool
+	hook := func(host string, results []PortResult) {
+		for _, r := range results {
+			if r.State != "open" {
+				continue
+			}
+			msg := fmt.Sprintf("run_id=%s host=%s port=%d proto=%s state=open service=%q", runID, host, r.Port, protocol, r.Service)
+			if err := w.Notice(msg); err != nil && !failed {
+				failed = true
+				fmt.Fprintln(os.Stderr, "Erro ao enviar para o syslog:", err)
+			}
+		}
+	}
+	return hook, w.Close, nil
+}
+
+func newSyslogWriter(addr string) (*syslog.Writer, error) {
+	if addr == "" {
+		return syslog.New(syslog.LOG_NOTICE|syslog.LOG_DAEMON, "argos")
+	}
+	network := "udp"
+	if n, rest, ok := strings.Cut(addr, "://"); ok {
+		network, addr = n, rest
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "514")
+	}
+	return syslog.Dial(network, addr, syslog.LOG_NOTICE|syslog.LOG_DAEMON, "argos")
+}
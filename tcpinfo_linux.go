@@ -0,0 +1,32 @@
+//go:build linux
+
+package main
+
+import (
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// readTCPDetails lê do kernel (TCP_INFO) a janela anunciada pelo host e o
+// MSS efetivo da conexão já estabelecida. Conexões que não expõem o socket,
+// como as abertas via proxy ou bastion SSH, não têm detalhes.
+func readTCPDetails(conn net.Conn) *TCPDetails {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return nil
+	}
+	var info *unix.TCPInfo
+	var infoErr error
+	if err := raw.Control(func(fd uintptr) {
+		info, infoErr = unix.GetsockoptTCPInfo(int(fd), unix.IPPROTO_TCP, unix.TCP_INFO)
+	}); err != nil || infoErr != nil {
+		return nil
+	}
+	return &TCPDetails{Window: info.Snd_wnd, MSS: info.Snd_mss}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "net"
+
+// readTCPDetails depende do TCP_INFO do Linux; nos demais sistemas a porta
+// aberta segue sem detalhes.
+func readTCPDetails(conn net.Conn) *TCPDetails {
+	return nil
+}